@@ -0,0 +1,438 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// exporterDefaults lists all known exporters and whether they are enabled
+// when neither the configuration file nor the environment says otherwise.
+var exporterDefaults = map[string]bool{
+	"cinder":     true,
+	"nova":       true,
+	"nova-trait": false,
+	"nova-pci":   false,
+	"neutron":    true,
+	"designate":  true,
+	"octavia":    true,
+	"manila":     false,
+	"glance":     false,
+	"keystone":   false,
+
+	"placement-capacity": false,
+	"placement-usage":    false,
+
+	"nova-quota":    false,
+	"cinder-quota":  false,
+	"neutron-quota": false,
+	"manila-quota":  false,
+	"octavia-quota": false,
+}
+
+// exporterDatabases maps exporters to their database, where it is not the
+// first part of the exporter name.
+var exporterDatabases = map[string]string{
+	"nova-quota": "nova_api",
+}
+
+type Config struct {
+	// Addresses to listen on, unix sockets are given as unix:///path/to/socket.
+	// listen_address is kept for a single address.
+	ListenAddress   string                     `yaml:"listen_address,omitempty"`
+	ListenAddresses []string                   `yaml:"listen_addresses,omitempty"`
+	MetricsPath     string                     `yaml:"metrics_path,omitempty"`
+	BaseDSN         string                     `yaml:"base_dsn,omitempty"`
+	CollectInterval time.Duration              `yaml:"collect_interval,omitempty"`
+	Regions         map[string]*RegionConfig   `yaml:"regions,omitempty"`
+	Exporters       map[string]*ExporterConfig `yaml:"exporters,omitempty"`
+}
+
+// RegionConfig configures the databases of one region. All enabled exporters
+// are instantiated for every region, and their metrics carry a region label.
+type RegionConfig struct {
+	BaseDSN string `yaml:"base_dsn,omitempty"`
+}
+
+// Region is a named database target. Without configured regions there is a
+// single region with an empty name, whose metrics carry no region label.
+type Region struct {
+	Name    string
+	BaseDSN string
+}
+
+type ExporterConfig struct {
+	Enabled *bool `yaml:"enabled,omitempty"`
+	// DSN of the service database. Defaults to the base DSN followed by the
+	// database name of the service. Not supported with regions.
+	DSN string `yaml:"dsn,omitempty"`
+
+	// nova, nova-pci: database names of the cells v2 cells, or discover them
+	// from the cell_mappings in nova_api. Either requires a base DSN. nova-pci
+	// uses the cells of nova unless configured itself.
+	Cells         []string `yaml:"cells,omitempty"`
+	DiscoverCells bool     `yaml:"discover_cells,omitempty"`
+	CellLabel     bool     `yaml:"cell_label,omitempty"`
+
+	// nova, cinder, manila: add an availability_zone label
+	AvailabilityZoneLabel bool `yaml:"availability_zone_label,omitempty"`
+
+	// nova-trait
+	Traits []string `yaml:"traits,omitempty"`
+
+	// nova-pci: report VGPUs from the placement database, requires a base DSN
+	VGPUs bool `yaml:"vgpus,omitempty"`
+
+	// neutron: detected from the external networks if empty
+	ExternalNetworkIDs []string `yaml:"external_network_ids,omitempty"`
+
+	// keystone
+	RefreshInterval time.Duration `yaml:"refresh_interval,omitempty"`
+
+	// *-quota: default quotas used where the database holds no default
+	Defaults map[string]float64 `yaml:"defaults,omitempty"`
+	// *-quota: expose the quotas of all projects in the keystone database,
+	// requires a base DSN
+	AllProjects bool `yaml:"all_projects,omitempty"`
+}
+
+// LoadConfig reads the configuration file at path, if any, applies the
+// environment variable overrides and validates the result.
+func LoadConfig(path string) (*Config, error) {
+	cfg := &Config{}
+
+	if path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		decoder := yaml.NewDecoder(f)
+		decoder.KnownFields(true)
+		if err := decoder.Decode(cfg); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+	}
+
+	// An exporter listed without any settings decodes to nil. It is dropped
+	// before the environment and defaults are applied, and reported together
+	// with the other errors.
+	var errs []error
+	for _, name := range sortedKeys(cfg.Exporters) {
+		if cfg.Exporters[name] == nil {
+			errs = append(errs, fmt.Errorf("exporter %s: empty configuration", name))
+			delete(cfg.Exporters, name)
+		}
+	}
+
+	if cfg.Exporters == nil {
+		cfg.Exporters = make(map[string]*ExporterConfig)
+	}
+	for name := range exporterDefaults {
+		if cfg.Exporters[name] == nil {
+			cfg.Exporters[name] = &ExporterConfig{}
+		}
+	}
+
+	errs = append(errs, cfg.applyEnv())
+	cfg.applyDefaults()
+
+	if err := errors.Join(append(errs, cfg.validate())...); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// EnabledExporters returns the names of all enabled exporters in sorted order.
+func (c *Config) EnabledExporters() []string {
+	var names []string
+	for name, exporter := range c.Exporters {
+		if *exporter.Enabled {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Targets returns the regions to export in sorted order.
+func (c *Config) Targets() []Region {
+	if len(c.Regions) == 0 {
+		return []Region{{BaseDSN: c.BaseDSN}}
+	}
+
+	var regions []Region
+	for name, region := range c.Regions {
+		regions = append(regions, Region{Name: name, BaseDSN: region.BaseDSN})
+	}
+	sort.Slice(regions, func(i, j int) bool {
+		return regions[i].Name < regions[j].Name
+	})
+	return regions
+}
+
+// ExporterDSN returns the DSN of the database of exporter name in region.
+func (c *Config) ExporterDSN(region Region, name string) string {
+	if dsn := c.Exporters[name].DSN; dsn != "" {
+		return dsn
+	}
+	return region.BaseDSN + "/" + exporterDatabase(name)
+}
+
+func exporterDatabase(name string) string {
+	if database, exists := exporterDatabases[name]; exists {
+		return database
+	}
+	return strings.Split(name, "-")[0]
+}
+
+func (c *Config) applyEnv() error {
+	var errs []error
+	if value, exists := os.LookupEnv("BASE_DSN"); exists {
+		c.BaseDSN = value
+	}
+	// e.g. LISTEN_ADDRESS=:9143,unix:///run/openstack-usage-exporter.sock
+	if value, exists := os.LookupEnv("LISTEN_ADDRESS"); exists {
+		c.ListenAddress = ""
+		c.ListenAddresses = splitList(value)
+	}
+	if value, exists := os.LookupEnv("METRICS_PATH"); exists {
+		c.MetricsPath = value
+	}
+	var err error
+	if c.CollectInterval, err = GetDurationEnv("COLLECT_INTERVAL", c.CollectInterval); err != nil {
+		errs = append(errs, err)
+	}
+
+	// e.g. REGIONS=regionone,regiontwo with BASE_DSN_REGIONONE and BASE_DSN_REGIONTWO
+	if value, exists := os.LookupEnv("REGIONS"); exists {
+		c.Regions = make(map[string]*RegionConfig)
+		for _, name := range splitList(value) {
+			key := "BASE_DSN_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+			c.Regions[name] = &RegionConfig{BaseDSN: os.Getenv(key)}
+		}
+	}
+
+	for name, exporter := range c.Exporters {
+		// e.g. NOVA_TRAIT_ENABLED and NOVA_TRAIT_DSN for nova-trait
+		prefix := strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+
+		if _, exists := os.LookupEnv(prefix + "_ENABLED"); exists {
+			enabled := GetBoolEnv(prefix+"_ENABLED", false)
+			exporter.Enabled = &enabled
+		}
+		if value, exists := os.LookupEnv(prefix + "_DSN"); exists {
+			exporter.DSN = value
+		}
+		exporter.AvailabilityZoneLabel = GetBoolEnv(prefix+"_AVAILABILITY_ZONE_LABEL", exporter.AvailabilityZoneLabel)
+		exporter.AllProjects = GetBoolEnv(prefix+"_ALL_PROJECTS", exporter.AllProjects)
+	}
+
+	nova := c.Exporters["nova"]
+	if value, exists := os.LookupEnv("NOVA_CELLS"); exists {
+		nova.Cells = splitList(value)
+	}
+	nova.DiscoverCells = GetBoolEnv("NOVA_DISCOVER_CELLS", nova.DiscoverCells)
+	nova.CellLabel = GetBoolEnv("NOVA_CELL_LABEL", nova.CellLabel)
+
+	if value, exists := os.LookupEnv("NOVA_TRAIT"); exists {
+		c.Exporters["nova-trait"].Traits = splitList(value)
+	}
+	novaPCI := c.Exporters["nova-pci"]
+	novaPCI.VGPUs = GetBoolEnv("NOVA_PCI_VGPUS", novaPCI.VGPUs)
+	if value, exists := os.LookupEnv("NEUTRON_ROUTER_EXTERNAL_NETWORK_ID"); exists {
+		c.Exporters["neutron"].ExternalNetworkIDs = splitList(value)
+	}
+	keystone := c.Exporters["keystone"]
+	if keystone.RefreshInterval, err = GetDurationEnv("KEYSTONE_REFRESH_INTERVAL", keystone.RefreshInterval); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
+
+func (c *Config) applyDefaults() {
+	if c.ListenAddress != "" && len(c.ListenAddresses) == 0 {
+		c.ListenAddresses = []string{c.ListenAddress}
+		c.ListenAddress = ""
+	}
+	if len(c.ListenAddresses) == 0 {
+		c.ListenAddresses = []string{":9143"}
+	}
+	if c.MetricsPath == "" {
+		c.MetricsPath = "/metrics"
+	}
+
+	for name, exporter := range c.Exporters {
+		if exporter.Enabled == nil {
+			enabled := exporterDefaults[name]
+			exporter.Enabled = &enabled
+		}
+	}
+
+	nova, novaPCI := c.Exporters["nova"], c.Exporters["nova-pci"]
+	if len(novaPCI.Cells) == 0 && !novaPCI.DiscoverCells {
+		novaPCI.Cells = nova.Cells
+		novaPCI.DiscoverCells = nova.DiscoverCells
+	}
+
+	if keystone := c.Exporters["keystone"]; keystone.RefreshInterval == 0 {
+		keystone.RefreshInterval = 5 * time.Minute
+	}
+}
+
+func (c *Config) validate() error {
+	var errs []error
+
+	if c.ListenAddress != "" {
+		errs = append(errs, errors.New("listen_address and listen_addresses are mutually exclusive"))
+	}
+	if !strings.HasPrefix(c.MetricsPath, "/") || c.MetricsPath == "/" {
+		errs = append(errs, fmt.Errorf("metrics_path %q must be an absolute path other than /", c.MetricsPath))
+	}
+	if c.MetricsPath == "/healthz" || c.MetricsPath == "/readyz" {
+		errs = append(errs, fmt.Errorf("metrics_path %q is reserved for the health checks", c.MetricsPath))
+	}
+	if c.CollectInterval < 0 {
+		errs = append(errs, errors.New("collect_interval must not be negative"))
+	}
+
+	if len(c.Regions) > 0 && c.BaseDSN != "" {
+		errs = append(errs, errors.New("base_dsn (BASE_DSN) cannot be combined with regions"))
+	}
+	// A region listed without any settings decodes to nil.
+	for _, name := range sortedKeys(c.Regions) {
+		if region := c.Regions[name]; region == nil || region.BaseDSN == "" {
+			errs = append(errs, fmt.Errorf("region %s: no base_dsn configured", name))
+		}
+	}
+
+	for _, name := range sortedKeys(c.Exporters) {
+		exporter := c.Exporters[name]
+		if _, known := exporterDefaults[name]; !known {
+			errs = append(errs, fmt.Errorf("unknown exporter %q", name))
+			continue
+		}
+		if !*exporter.Enabled {
+			continue
+		}
+
+		if len(c.Regions) > 0 && exporter.DSN != "" {
+			errs = append(errs, fmt.Errorf("exporter %s: dsn cannot be combined with regions", name))
+		}
+		if len(c.Regions) == 0 && exporter.DSN == "" && c.BaseDSN == "" {
+			errs = append(errs, fmt.Errorf("exporter %s: no dsn configured and BASE_DSN not set", name))
+		}
+		if (len(exporter.Cells) > 0 || exporter.DiscoverCells) && name != "nova" && name != "nova-pci" {
+			errs = append(errs, fmt.Errorf("exporter %s: cells are only supported by nova and nova-pci", name))
+		}
+		if exporter.CellLabel && name != "nova" {
+			errs = append(errs, fmt.Errorf("exporter %s: cell_label is only supported by nova", name))
+		}
+		if len(exporter.Cells) > 0 && exporter.DiscoverCells {
+			errs = append(errs, fmt.Errorf("exporter %s: cells and discover_cells are mutually exclusive", name))
+		}
+		if (len(exporter.Cells) > 0 || exporter.DiscoverCells) && len(c.Regions) == 0 && c.BaseDSN == "" {
+			errs = append(errs, fmt.Errorf("exporter %s: cells require base_dsn (BASE_DSN)", name))
+		}
+		if exporter.AvailabilityZoneLabel && name != "nova" && name != "cinder" && name != "manila" {
+			errs = append(errs, fmt.Errorf("exporter %s: availability_zone_label is only supported by nova, cinder and manila", name))
+		}
+		if len(exporter.Traits) > 0 && name != "nova-trait" {
+			errs = append(errs, fmt.Errorf("exporter %s: traits are only supported by nova-trait", name))
+		}
+		if exporter.VGPUs && name != "nova-pci" {
+			errs = append(errs, fmt.Errorf("exporter %s: vgpus are only supported by nova-pci", name))
+		}
+		if exporter.VGPUs && len(c.Regions) == 0 && c.BaseDSN == "" {
+			errs = append(errs, fmt.Errorf("exporter %s: vgpus require base_dsn (BASE_DSN)", name))
+		}
+		if len(exporter.ExternalNetworkIDs) > 0 && name != "neutron" {
+			errs = append(errs, fmt.Errorf("exporter %s: external_network_ids are only supported by neutron", name))
+		}
+		if exporter.RefreshInterval != 0 && name != "keystone" {
+			errs = append(errs, fmt.Errorf("exporter %s: refresh_interval is only supported by keystone", name))
+		}
+		if len(exporter.Defaults) > 0 && !strings.HasSuffix(name, "-quota") {
+			errs = append(errs, fmt.Errorf("exporter %s: defaults are only supported by quota exporters", name))
+		}
+		if exporter.AllProjects && !strings.HasSuffix(name, "-quota") {
+			errs = append(errs, fmt.Errorf("exporter %s: all_projects is only supported by quota exporters", name))
+		}
+		if exporter.AllProjects && len(c.Regions) == 0 && c.BaseDSN == "" {
+			errs = append(errs, fmt.Errorf("exporter %s: all_projects requires base_dsn (BASE_DSN)", name))
+		}
+		if exporter.RefreshInterval < 0 {
+			errs = append(errs, fmt.Errorf("exporter %s: refresh_interval must not be negative", name))
+		}
+	}
+
+	if nova := c.Exporters["nova-trait"]; *nova.Enabled && len(nova.Traits) == 0 {
+		errs = append(errs, errors.New("exporter nova-trait: no traits configured (NOVA_TRAIT not set)"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Redacted returns a copy of the configuration with all database passwords
+// replaced, for display.
+func (c *Config) Redacted() *Config {
+	redacted := *c
+	redacted.BaseDSN = redactDSN(c.BaseDSN)
+
+	redacted.Regions = make(map[string]*RegionConfig, len(c.Regions))
+	for name, region := range c.Regions {
+		redacted.Regions[name] = &RegionConfig{BaseDSN: redactDSN(region.BaseDSN)}
+	}
+
+	redacted.Exporters = make(map[string]*ExporterConfig, len(c.Exporters))
+	for name, exporter := range c.Exporters {
+		exporterCopy := *exporter
+		exporterCopy.DSN = redactDSN(exporter.DSN)
+		redacted.Exporters[name] = &exporterCopy
+	}
+
+	return &redacted
+}
+
+// redactDSN replaces the password of a DSN like user:password@tcp(host)/db.
+// The password may contain @, so the last one ends the credentials.
+func redactDSN(dsn string) string {
+	at := strings.LastIndex(dsn, "@")
+	if at < 0 {
+		return dsn
+	}
+	colon := strings.Index(dsn[:at], ":")
+	if colon < 0 {
+		return dsn
+	}
+	return dsn[:colon+1] + "<secret>" + dsn[at:]
+}
+
+// sortedKeys returns the keys of m in sorted order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// splitList splits a comma separated environment variable value.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		env    map[string]string
+		check  func(t *testing.T, cfg *Config)
+	}{
+		{
+			name: "environment overrides file",
+			config: `
+base_dsn: "file:secret@tcp(db-file)"
+collect_interval: 1m
+exporters:
+  cinder:
+    dsn: "cinder:secret@tcp(cinder-file)/cinder"
+`,
+			env: map[string]string{
+				"BASE_DSN":          "env:secret@tcp(db-env)",
+				"COLLECT_INTERVAL":  "5m",
+				"CINDER_DSN":        "cinder:secret@tcp(cinder-env)/cinder",
+				"DESIGNATE_ENABLED": "false",
+			},
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.BaseDSN != "env:secret@tcp(db-env)" {
+					t.Errorf("unexpected base DSN: %s", cfg.BaseDSN)
+				}
+				if cfg.CollectInterval != 5*time.Minute {
+					t.Errorf("unexpected collect interval: %s", cfg.CollectInterval)
+				}
+				if dsn := cfg.Exporters["cinder"].DSN; dsn != "cinder:secret@tcp(cinder-env)/cinder" {
+					t.Errorf("unexpected cinder DSN: %s", dsn)
+				}
+				if *cfg.Exporters["designate"].Enabled {
+					t.Error("designate should be disabled")
+				}
+			},
+		},
+		{
+			name: "file settings without environment",
+			config: `
+base_dsn: "file:secret@tcp(db-file)"
+exporters:
+  manila:
+    enabled: true
+`,
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.BaseDSN != "file:secret@tcp(db-file)" {
+					t.Errorf("unexpected base DSN: %s", cfg.BaseDSN)
+				}
+				if !*cfg.Exporters["manila"].Enabled {
+					t.Error("manila should be enabled")
+				}
+				if !reflect.DeepEqual(cfg.ListenAddresses, []string{":9143"}) || cfg.MetricsPath != "/metrics" {
+					t.Errorf("unexpected defaults: %v %s", cfg.ListenAddresses, cfg.MetricsPath)
+				}
+			},
+		},
+		{
+			name: "legacy environment variables",
+			env: map[string]string{
+				"BASE_DSN":                           "env:secret@tcp(db-env)",
+				"NOVA_TRAIT_ENABLED":                 "true",
+				"NOVA_TRAIT":                         "CUSTOM_GPU, CUSTOM_NVME",
+				"NEUTRON_ROUTER_EXTERNAL_NETWORK_ID": "7a5fdb8e-4c46-4b21-a4c5-7e1e2ad4b0c1",
+			},
+			check: func(t *testing.T, cfg *Config) {
+				if traits := cfg.Exporters["nova-trait"].Traits; !reflect.DeepEqual(traits, []string{"CUSTOM_GPU", "CUSTOM_NVME"}) {
+					t.Errorf("unexpected traits: %v", traits)
+				}
+				if ids := cfg.Exporters["neutron"].ExternalNetworkIDs; !reflect.DeepEqual(ids, []string{"7a5fdb8e-4c46-4b21-a4c5-7e1e2ad4b0c1"}) {
+					t.Errorf("unexpected external network ids: %v", ids)
+				}
+			},
+		},
+		{
+			name: "placement capacity without base DSN",
+			config: `
+exporters:
+  placement-capacity:
+    enabled: true
+    dsn: "placement:secret@tcp(placement-db)/placement"
+  cinder: {enabled: false}
+  designate: {enabled: false}
+  neutron: {enabled: false}
+  nova: {enabled: false}
+  octavia: {enabled: false}
+`,
+			check: func(t *testing.T, cfg *Config) {
+				if !reflect.DeepEqual(cfg.EnabledExporters(), []string{"placement-capacity"}) {
+					t.Errorf("unexpected enabled exporters: %v", cfg.EnabledExporters())
+				}
+			},
+		},
+		{
+			name: "regions from environment",
+			env: map[string]string{
+				"REGIONS":             "regionone,region-two",
+				"BASE_DSN_REGIONONE":  "one:secret@tcp(db1)",
+				"BASE_DSN_REGION_TWO": "two:secret@tcp(db2)",
+			},
+			check: func(t *testing.T, cfg *Config) {
+				expected := []Region{
+					{Name: "region-two", BaseDSN: "two:secret@tcp(db2)"},
+					{Name: "regionone", BaseDSN: "one:secret@tcp(db1)"},
+				}
+				if targets := cfg.Targets(); !reflect.DeepEqual(targets, expected) {
+					t.Errorf("unexpected targets: %v", targets)
+				}
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for key, value := range test.env {
+				t.Setenv(key, value)
+			}
+
+			cfg, err := LoadConfig(writeConfig(t, test.config))
+			if err != nil {
+				t.Fatalf("Failed to load configuration: %v", err)
+			}
+			test.check(t, cfg)
+		})
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		env    map[string]string
+		errors []string
+	}{
+		{
+			name: "unknown exporter",
+			config: `
+base_dsn: "u:p@tcp(db)"
+exporters:
+  nova_trait:
+    enabled: true
+`,
+			errors: []string{`unknown exporter "nova_trait"`},
+		},
+		{
+			name: "empty exporter",
+			config: `
+base_dsn: "u:p@tcp(db)"
+exporters:
+  nova_trait:
+  nova:
+`,
+			errors: []string{"exporter nova: empty configuration", "exporter nova_trait: empty configuration"},
+		},
+		{
+			name: "empty region",
+			config: `
+regions:
+  regionone:
+  regiontwo:
+    base_dsn: "u:p@tcp(db2)"
+`,
+			errors: []string{"region regionone: no base_dsn configured"},
+		},
+		{
+			name: "region combined with base DSN",
+			config: `
+base_dsn: "u:p@tcp(db)"
+regions:
+  regionone:
+    base_dsn: "u:p@tcp(db1)"
+`,
+			errors: []string{"base_dsn (BASE_DSN) cannot be combined with regions"},
+		},
+		{
+			name: "all problems reported at once",
+			config: `
+base_dsn: "u:p@tcp(db)"
+exporters:
+  foo:
+    enabled: true
+`,
+			env: map[string]string{
+				"COLLECT_INTERVAL":          "often",
+				"KEYSTONE_REFRESH_INTERVAL": "sometimes",
+				"METRICS_PATH":              "/readyz",
+			},
+			errors: []string{
+				"invalid duration for COLLECT_INTERVAL",
+				"invalid duration for KEYSTONE_REFRESH_INTERVAL",
+				`metrics_path "/readyz" is reserved`,
+				`unknown exporter "foo"`,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for key, value := range test.env {
+				t.Setenv(key, value)
+			}
+
+			_, err := LoadConfig(writeConfig(t, test.config))
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			for _, expected := range test.errors {
+				if !strings.Contains(err.Error(), expected) {
+					t.Errorf("expected %q in error:\n%s", expected, err)
+				}
+			}
+		})
+	}
+}
+
+func TestRedactDSN(t *testing.T) {
+	tests := []struct {
+		dsn      string
+		expected string
+	}{
+		{"user:secret@tcp(db:3306)", "user:<secret>@tcp(db:3306)"},
+		{"user:secret@tcp(db:3306)/nova?parseTime=true", "user:<secret>@tcp(db:3306)/nova?parseTime=true"},
+		{"user:s3cr@t:x@tcp(db)/nova", "user:<secret>@tcp(db)/nova"},
+		{"user@tcp(db:3306)/nova", "user@tcp(db:3306)/nova"},
+		{"tcp(db:3306)/nova", "tcp(db:3306)/nova"},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		if redacted := redactDSN(test.dsn); redacted != test.expected {
+			t.Errorf("redactDSN(%q) = %q, expected %q", test.dsn, redacted, test.expected)
+		}
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	cfg, err := LoadConfig(writeConfig(t, `
+regions:
+  regionone:
+    base_dsn: "u:secret@tcp(db1)"
+exporters:
+  cinder:
+    enabled: true
+`))
+	if err != nil {
+		t.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	redacted := cfg.Redacted()
+	if dsn := redacted.Regions["regionone"].BaseDSN; dsn != "u:<secret>@tcp(db1)" {
+		t.Errorf("unexpected redacted region DSN: %s", dsn)
+	}
+	if dsn := cfg.Regions["regionone"].BaseDSN; dsn != "u:secret@tcp(db1)" {
+		t.Errorf("the configuration itself must not be redacted: %s", dsn)
+	}
+}
+
+// writeConfig writes config to a temporary file and returns its path, or an
+// empty path without config.
+func writeConfig(t *testing.T, config string) string {
+	t.Helper()
+	if config == "" {
+		return ""
+	}
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatalf("Failed to write configuration: %v", err)
+	}
+	return path
+}
@@ -0,0 +1,14 @@
+package exporters
+
+// availabilityZoneColumn returns the select expression of the availability
+// zone column of the exporters supporting an optional availability_zone
+// label. Without the label all rows share the empty zone. Queries using it
+// group by column position, as GROUP BY availability_zone would refer to the
+// availability_zone column of the table rather than the expression and split
+// the rows by zone even without the label.
+func availabilityZoneColumn(enabled bool, column string) string {
+	if !enabled {
+		return "''"
+	}
+	return "COALESCE(" + column + ", 'unknown')"
+}
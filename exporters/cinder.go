@@ -8,37 +8,47 @@ import (
 )
 
 type CinderUsageExporter struct {
-	db                  *sql.DB
-	volumes             *prometheus.Desc
-	volumesSize         *prometheus.Desc
-	snapshots           *prometheus.Desc
-	snapshotsSize		*prometheus.Desc
-	backups		        *prometheus.Desc
-	backupsSize         *prometheus.Desc
+	db                    *sql.DB
+	availabilityZoneLabel bool
+	volumes               *prometheus.Desc
+	volumesSize           *prometheus.Desc
+	snapshots             *prometheus.Desc
+	snapshotsSize         *prometheus.Desc
+	backups               *prometheus.Desc
+	backupsSize           *prometheus.Desc
 }
 
-func NewCinderUsageExporter(db *sql.DB) (*CinderUsageExporter, error) {
+// NewCinderUsageExporter creates a Cinder exporter. With
+// availabilityZoneLabel volumes and snapshots carry the availability zone of
+// the volume.
+func NewCinderUsageExporter(db *sql.DB, availabilityZoneLabel bool) (*CinderUsageExporter, error) {
+	volumeLabels := []string{"project_id", "volume_type"}
+	if availabilityZoneLabel {
+		volumeLabels = append(volumeLabels, "availability_zone")
+	}
+
 	return &CinderUsageExporter{
-		db: db,
+		db:                    db,
+		availabilityZoneLabel: availabilityZoneLabel,
 		volumes: prometheus.NewDesc(
 			"openstack_project_volumes",
-			"Total number of volumes per OpenStack project",
-			[]string{"project_id"}, nil,
+			"Total number of volumes per OpenStack project and volume type",
+			volumeLabels, nil,
 		),
 		volumesSize: prometheus.NewDesc(
 			"openstack_project_volume_size_gb",
-			"Total volume size in GB per OpenStack project",
-			[]string{"project_id"}, nil,
+			"Total volume size in GB per OpenStack project and volume type",
+			volumeLabels, nil,
 		),
 		snapshots: prometheus.NewDesc(
 			"openstack_project_snapshots",
-			"Total number of snapshots per OpenStack project",
-			[]string{"project_id"}, nil,
+			"Total number of snapshots per OpenStack project and volume type",
+			volumeLabels, nil,
 		),
 		snapshotsSize: prometheus.NewDesc(
 			"openstack_project_snapshots_size_gb",
-			"Total size of snapshots in GB per OpenStack project",
-			[]string{"project_id"}, nil,
+			"Total size of snapshots in GB per OpenStack project and volume type",
+			volumeLabels, nil,
 		),
 		backups: prometheus.NewDesc(
 			"openstack_project_backups",
@@ -66,84 +76,106 @@ func (e *CinderUsageExporter) Collect(ch chan<- prometheus.Metric) {
 	e.collectMetrics(ch)
 }
 
-func (e *CinderUsageExporter) collectMetrics(ch chan<- prometheus.Metric) {
-	rows, err := e.db.Query("SELECT project_id, COUNT(id) AS total_volumes, SUM(size) AS volumes_size_gb FROM volumes WHERE deleted = 0 GROUP BY project_id")
+func (e *CinderUsageExporter) collectMetrics(ch chan<- prometheus.Metric) error {
+	// Volumes and snapshots are grouped by the volume type name rather than its id,
+	// so a deleted type and its re-created successor of the same name end up in one
+	// series. Volumes without a (resolvable) type are reported as "unknown".
+	// Columns are grouped by position, see availabilityZoneColumn.
+	rows, err := e.db.Query(`
+		SELECT vl.project_id, COALESCE(vt.name, 'unknown') AS volume_type, ` + availabilityZoneColumn(e.availabilityZoneLabel, "vl.availability_zone") + ` AS availability_zone, COUNT(vl.id) AS total_volumes, SUM(vl.size) AS volumes_size_gb
+		FROM volumes vl
+		LEFT JOIN volume_types vt ON vl.volume_type_id = vt.id
+		WHERE vl.deleted = 0
+		GROUP BY 1, 2, 3
+	`)
 	if err != nil {
 		log.Println("Error querying Volumes:", err)
-		return
+		return &queryError{query: "volumes", err: err}
 	}
 	defer rows.Close()
 
-	volumesData := make(map[string]struct {
-		totalVolumes    float64
-		totalVolumesSizeGB   float64
-	})
+	type volumeTypeKey struct {
+		projectID        string
+		volumeType       string
+		availabilityZone string
+	}
+
+	type volumeTypeUsage struct {
+		total  float64
+		sizeGB float64
+	}
+
+	volumesData := make(map[volumeTypeKey]*volumeTypeUsage)
 
 	for rows.Next() {
-		var projectID string
+		var projectID, volumeType, availabilityZone string
 		var totalVolumes, volumesSize float64
 
-		if err := rows.Scan(&projectID, &totalVolumes, &volumesSize); err != nil {
+		if err := rows.Scan(&projectID, &volumeType, &availabilityZone, &totalVolumes, &volumesSize); err != nil {
 			log.Println("Error scanning Volumes row:", err)
 			continue
 		}
 
-		volumesData[projectID] = struct {
-			totalVolumes  float64
-			totalVolumesSizeGB float64
-		}{
-			totalVolumes:  totalVolumes,
-			totalVolumesSizeGB: volumesSize,
+		key := volumeTypeKey{projectID, volumeType, availabilityZone}
+		if volumesData[key] == nil {
+			volumesData[key] = &volumeTypeUsage{}
 		}
+		volumesData[key].total += totalVolumes
+		volumesData[key].sizeGB += volumesSize
 	}
 
 	if err := rows.Err(); err != nil {
 		log.Println("Error in Volumes result set:", err)
+		return &queryError{query: "volumes", err: err}
 	}
 
-	rows, err = e.db.Query("SELECT project_id, COUNT(id) AS total_snapshots, SUM(volume_size) AS snapshot_size_gb FROM snapshots WHERE deleted = 0 GROUP BY project_id")
+	rows, err = e.db.Query(`
+		SELECT sn.project_id, COALESCE(vt.name, 'unknown') AS volume_type, ` + availabilityZoneColumn(e.availabilityZoneLabel, "vl.availability_zone") + ` AS availability_zone, COUNT(sn.id) AS total_snapshots, SUM(sn.volume_size) AS snapshot_size_gb
+		FROM snapshots sn
+		LEFT JOIN volume_types vt ON sn.volume_type_id = vt.id
+		LEFT JOIN volumes vl ON sn.volume_id = vl.id
+		WHERE sn.deleted = 0
+		GROUP BY 1, 2, 3
+	`)
 	if err != nil {
 		log.Println("Error querying Snapshotss:", err)
-		return
+		return &queryError{query: "snapshots", err: err}
 	}
 	defer rows.Close()
 
-	snapshotsData := make(map[string]struct {
-		totalSnapshots    float64
-		totalSnapshotsSizeGB   float64
-	})
+	snapshotsData := make(map[volumeTypeKey]*volumeTypeUsage)
 
 	for rows.Next() {
-		var projectID string
+		var projectID, volumeType, availabilityZone string
 		var totalSnapshots, snapshotsSize float64
 
-		if err := rows.Scan(&projectID, &totalSnapshots, &snapshotsSize); err != nil {
+		if err := rows.Scan(&projectID, &volumeType, &availabilityZone, &totalSnapshots, &snapshotsSize); err != nil {
 			log.Println("Error scanning Snapshots row:", err)
 			continue
 		}
 
-		snapshotsData[projectID] = struct {
-			totalSnapshots  float64
-			totalSnapshotsSizeGB float64
-		}{
-			totalSnapshots:  totalSnapshots,
-			totalSnapshotsSizeGB: snapshotsSize,
+		key := volumeTypeKey{projectID, volumeType, availabilityZone}
+		if snapshotsData[key] == nil {
+			snapshotsData[key] = &volumeTypeUsage{}
 		}
+		snapshotsData[key].total += totalSnapshots
+		snapshotsData[key].sizeGB += snapshotsSize
 	}
 
 	if err := rows.Err(); err != nil {
 		log.Println("Error in Snapshots result set:", err)
+		return &queryError{query: "snapshots", err: err}
 	}
 
 	rows, err = e.db.Query("SELECT project_id, COUNT(id) AS total_backups, SUM(size) AS total_backups_size_gb FROM backups WHERE deleted = 0 GROUP BY project_id")
 	if err != nil {
 		log.Println("Error querying Backups:", err)
-		return
+		return &queryError{query: "backups", err: err}
 	}
 	defer rows.Close()
 
 	backupsData := make(map[string]struct {
-		totalBackups      float64
+		totalBackups       float64
 		totalBackupsSizeGB float64
 	})
 
@@ -157,50 +189,52 @@ func (e *CinderUsageExporter) collectMetrics(ch chan<- prometheus.Metric) {
 		}
 
 		backupsData[projectID] = struct {
-			totalBackups      float64
+			totalBackups       float64
 			totalBackupsSizeGB float64
 		}{
-			totalBackups:      totalBackups,
+			totalBackups:       totalBackups,
 			totalBackupsSizeGB: totalBackupsSizeGB,
 		}
 	}
 
 	if err := rows.Err(); err != nil {
 		log.Println("Error in Backups result set:", err)
+		return &queryError{query: "backups", err: err}
 	}
 
-	for projectID, volumes := range volumesData {
-		snapshots := snapshotsData[projectID]
-		backups := backupsData[projectID]
-
+	for key, volumes := range volumesData {
 		ch <- prometheus.MustNewConstMetric(
 			e.volumes,
 			prometheus.GaugeValue,
-			volumes.totalVolumes,
-			projectID,
+			volumes.total,
+			e.volumeLabelValues(key.projectID, key.volumeType, key.availabilityZone)...,
 		)
 
 		ch <- prometheus.MustNewConstMetric(
 			e.volumesSize,
 			prometheus.GaugeValue,
-			volumes.totalVolumesSizeGB,
-			projectID,
+			volumes.sizeGB,
+			e.volumeLabelValues(key.projectID, key.volumeType, key.availabilityZone)...,
 		)
+	}
 
+	for key, snapshots := range snapshotsData {
 		ch <- prometheus.MustNewConstMetric(
 			e.snapshots,
 			prometheus.GaugeValue,
-			snapshots.totalSnapshots,
-			projectID,
+			snapshots.total,
+			e.volumeLabelValues(key.projectID, key.volumeType, key.availabilityZone)...,
 		)
 
 		ch <- prometheus.MustNewConstMetric(
 			e.snapshotsSize,
 			prometheus.GaugeValue,
-			snapshots.totalSnapshotsSizeGB,
-			projectID,
+			snapshots.sizeGB,
+			e.volumeLabelValues(key.projectID, key.volumeType, key.availabilityZone)...,
 		)
+	}
 
+	for projectID, backups := range backupsData {
 		ch <- prometheus.MustNewConstMetric(
 			e.backups,
 			prometheus.GaugeValue,
@@ -215,4 +249,14 @@ func (e *CinderUsageExporter) collectMetrics(ch chan<- prometheus.Metric) {
 			projectID,
 		)
 	}
+
+	return nil
+}
+
+// volumeLabelValues returns the label values of the volume and snapshot metrics.
+func (e *CinderUsageExporter) volumeLabelValues(projectID, volumeType, availabilityZone string) []string {
+	if e.availabilityZoneLabel {
+		return []string{projectID, volumeType, availabilityZone}
+	}
+	return []string{projectID, volumeType}
 }
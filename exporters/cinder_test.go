@@ -17,17 +17,18 @@ func TestCinderUsageExporter(t *testing.T) {
 	defer db.Close()
 
 	volumeRows := sqlmock.NewRows([]string{
-		"project_id", "total_volumes", "volumes_size_gb"}).
-		AddRow("6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096", 2, 10).
-		AddRow("c352b0ed-30ca-4634-9c2d-1947efc29096", 12, 43)
-	mock.ExpectQuery(regexp.QuoteMeta("SELECT project_id, COUNT(id) AS total_volumes, SUM(size) AS volumes_size_gb FROM volumes WHERE deleted = 0 GROUP BY project_id")).
+		"project_id", "volume_type", "availability_zone", "total_volumes", "volumes_size_gb"}).
+		AddRow("6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096", "SSD", "", 2, 10).
+		AddRow("c352b0ed-30ca-4634-9c2d-1947efc29096", "HDD", "", 10, 40).
+		AddRow("c352b0ed-30ca-4634-9c2d-1947efc29096", "unknown", "", 2, 3)
+	mock.ExpectQuery(regexp.QuoteMeta("FROM volumes vl LEFT JOIN volume_types vt ON vl.volume_type_id = vt.id WHERE vl.deleted = 0 GROUP BY 1, 2, 3")).
 		WillReturnRows(volumeRows)
 
 	snapshotRows := sqlmock.NewRows([]string{
-		"project_id", "total_snapshots", "snapshot_size_gb"}).
-		AddRow("6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096", 2, 8).
-		AddRow("c352b0ed-30ca-4634-9c2d-1947efc29096", 5, 15)
-	mock.ExpectQuery(regexp.QuoteMeta("SELECT project_id, COUNT(id) AS total_snapshots, SUM(volume_size) AS snapshot_size_gb FROM snapshots WHERE deleted = 0 GROUP BY project_id")).
+		"project_id", "volume_type", "availability_zone", "total_snapshots", "snapshot_size_gb"}).
+		AddRow("6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096", "SSD", "", 2, 8).
+		AddRow("c352b0ed-30ca-4634-9c2d-1947efc29096", "HDD", "", 5, 15)
+	mock.ExpectQuery(regexp.QuoteMeta("FROM snapshots sn LEFT JOIN volume_types vt ON sn.volume_type_id = vt.id LEFT JOIN volumes vl ON sn.volume_id = vl.id WHERE sn.deleted = 0 GROUP BY 1, 2, 3")).
 		WillReturnRows(snapshotRows)
 
 	backupRows := sqlmock.NewRows([]string{
@@ -37,7 +38,7 @@ func TestCinderUsageExporter(t *testing.T) {
 	mock.ExpectQuery(regexp.QuoteMeta("SELECT project_id, COUNT(id) AS total_backups, SUM(size) AS total_backups_size_gb FROM backups WHERE deleted = 0 GROUP BY project_id")).
 		WillReturnRows(backupRows)
 
-	exporter, err := NewCinderUsageExporter(db)
+	exporter, err := NewCinderUsageExporter(db, false)
 	if err != nil {
 		t.Fatalf("Failed to create NewCinderUsageExporter: %v", err)
 	}
@@ -51,22 +52,24 @@ func TestCinderUsageExporter(t *testing.T) {
         # TYPE openstack_project_backups_size_gb gauge
         openstack_project_backups_size_gb{project_id="6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096"} 5
         openstack_project_backups_size_gb{project_id="c352b0ed-30ca-4634-9c2d-1947efc29096"} 10
-        # HELP openstack_project_snapshots Total number of snapshots per OpenStack project
+        # HELP openstack_project_snapshots Total number of snapshots per OpenStack project and volume type
         # TYPE openstack_project_snapshots gauge
-        openstack_project_snapshots{project_id="6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096"} 2
-        openstack_project_snapshots{project_id="c352b0ed-30ca-4634-9c2d-1947efc29096"} 5
-        # HELP openstack_project_snapshots_size_gb Total size of snapshots in GB per OpenStack project
+        openstack_project_snapshots{project_id="6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096",volume_type="SSD"} 2
+        openstack_project_snapshots{project_id="c352b0ed-30ca-4634-9c2d-1947efc29096",volume_type="HDD"} 5
+        # HELP openstack_project_snapshots_size_gb Total size of snapshots in GB per OpenStack project and volume type
         # TYPE openstack_project_snapshots_size_gb gauge
-        openstack_project_snapshots_size_gb{project_id="6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096"} 8
-        openstack_project_snapshots_size_gb{project_id="c352b0ed-30ca-4634-9c2d-1947efc29096"} 15
-        # HELP openstack_project_volume_size_gb Total volume size in GB per OpenStack project
+        openstack_project_snapshots_size_gb{project_id="6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096",volume_type="SSD"} 8
+        openstack_project_snapshots_size_gb{project_id="c352b0ed-30ca-4634-9c2d-1947efc29096",volume_type="HDD"} 15
+        # HELP openstack_project_volume_size_gb Total volume size in GB per OpenStack project and volume type
         # TYPE openstack_project_volume_size_gb gauge
-        openstack_project_volume_size_gb{project_id="6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096"} 10
-        openstack_project_volume_size_gb{project_id="c352b0ed-30ca-4634-9c2d-1947efc29096"} 43
-        # HELP openstack_project_volumes Total number of volumes per OpenStack project
+        openstack_project_volume_size_gb{project_id="6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096",volume_type="SSD"} 10
+        openstack_project_volume_size_gb{project_id="c352b0ed-30ca-4634-9c2d-1947efc29096",volume_type="HDD"} 40
+        openstack_project_volume_size_gb{project_id="c352b0ed-30ca-4634-9c2d-1947efc29096",volume_type="unknown"} 3
+        # HELP openstack_project_volumes Total number of volumes per OpenStack project and volume type
         # TYPE openstack_project_volumes gauge
-        openstack_project_volumes{project_id="6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096"} 2
-        openstack_project_volumes{project_id="c352b0ed-30ca-4634-9c2d-1947efc29096"} 12
+        openstack_project_volumes{project_id="6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096",volume_type="SSD"} 2
+        openstack_project_volumes{project_id="c352b0ed-30ca-4634-9c2d-1947efc29096",volume_type="HDD"} 10
+        openstack_project_volumes{project_id="c352b0ed-30ca-4634-9c2d-1947efc29096",volume_type="unknown"} 2
 	`
 
 	if err := testutil.CollectAndCompare(exporter, strings.NewReader(expectedMetrics)); err != nil {
@@ -77,3 +80,93 @@ func TestCinderUsageExporter(t *testing.T) {
 		t.Errorf("There were unfulfilled expectations: %s", err)
 	}
 }
+
+func TestCinderUsageExporterAvailabilityZones(t *testing.T) {
+	tests := []struct {
+		name                  string
+		availabilityZoneLabel bool
+		availabilityZone      string
+		zones                 []string
+		expectedMetrics       string
+	}{
+		{
+			name:                  "with label",
+			availabilityZoneLabel: true,
+			availabilityZone:      "COALESCE(vl.availability_zone, 'unknown') AS availability_zone",
+			zones:                 []string{"az1", "az2"},
+			expectedMetrics: `
+        # HELP openstack_project_snapshots Total number of snapshots per OpenStack project and volume type
+        # TYPE openstack_project_snapshots gauge
+        openstack_project_snapshots{availability_zone="az1",project_id="c352b0ed-30ca-4634-9c2d-1947efc29096",volume_type="SSD"} 1
+        openstack_project_snapshots{availability_zone="az2",project_id="c352b0ed-30ca-4634-9c2d-1947efc29096",volume_type="SSD"} 4
+        # HELP openstack_project_volume_size_gb Total volume size in GB per OpenStack project and volume type
+        # TYPE openstack_project_volume_size_gb gauge
+        openstack_project_volume_size_gb{availability_zone="az1",project_id="c352b0ed-30ca-4634-9c2d-1947efc29096",volume_type="SSD"} 10
+        openstack_project_volume_size_gb{availability_zone="az2",project_id="c352b0ed-30ca-4634-9c2d-1947efc29096",volume_type="SSD"} 30
+        # HELP openstack_project_volumes Total number of volumes per OpenStack project and volume type
+        # TYPE openstack_project_volumes gauge
+        openstack_project_volumes{availability_zone="az1",project_id="c352b0ed-30ca-4634-9c2d-1947efc29096",volume_type="SSD"} 2
+        openstack_project_volumes{availability_zone="az2",project_id="c352b0ed-30ca-4634-9c2d-1947efc29096",volume_type="SSD"} 3
+			`,
+		},
+		{
+			// Rows of the same project and type are summed up even if the
+			// database returns them separately.
+			name:                  "without label",
+			availabilityZoneLabel: false,
+			availabilityZone:      "'' AS availability_zone",
+			zones:                 []string{"", ""},
+			expectedMetrics: `
+        # HELP openstack_project_snapshots Total number of snapshots per OpenStack project and volume type
+        # TYPE openstack_project_snapshots gauge
+        openstack_project_snapshots{project_id="c352b0ed-30ca-4634-9c2d-1947efc29096",volume_type="SSD"} 5
+        # HELP openstack_project_volume_size_gb Total volume size in GB per OpenStack project and volume type
+        # TYPE openstack_project_volume_size_gb gauge
+        openstack_project_volume_size_gb{project_id="c352b0ed-30ca-4634-9c2d-1947efc29096",volume_type="SSD"} 40
+        # HELP openstack_project_volumes Total number of volumes per OpenStack project and volume type
+        # TYPE openstack_project_volumes gauge
+        openstack_project_volumes{project_id="c352b0ed-30ca-4634-9c2d-1947efc29096",volume_type="SSD"} 5
+			`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("Failed to create sqlmock: %v", err)
+			}
+			defer db.Close()
+
+			volumeRows := sqlmock.NewRows([]string{
+				"project_id", "volume_type", "availability_zone", "total_volumes", "volumes_size_gb"}).
+				AddRow("c352b0ed-30ca-4634-9c2d-1947efc29096", "SSD", test.zones[0], 2, 10).
+				AddRow("c352b0ed-30ca-4634-9c2d-1947efc29096", "SSD", test.zones[1], 3, 30)
+			mock.ExpectQuery(regexp.QuoteMeta(test.availabilityZone + ", COUNT(vl.id) AS total_volumes, SUM(vl.size) AS volumes_size_gb FROM volumes vl LEFT JOIN volume_types vt ON vl.volume_type_id = vt.id WHERE vl.deleted = 0 GROUP BY 1, 2, 3")).
+				WillReturnRows(volumeRows)
+
+			snapshotRows := sqlmock.NewRows([]string{
+				"project_id", "volume_type", "availability_zone", "total_snapshots", "snapshot_size_gb"}).
+				AddRow("c352b0ed-30ca-4634-9c2d-1947efc29096", "SSD", test.zones[0], 1, 5).
+				AddRow("c352b0ed-30ca-4634-9c2d-1947efc29096", "SSD", test.zones[1], 4, 20)
+			mock.ExpectQuery(regexp.QuoteMeta(test.availabilityZone + ", COUNT(sn.id) AS total_snapshots")).
+				WillReturnRows(snapshotRows)
+
+			mock.ExpectQuery(regexp.QuoteMeta("FROM backups")).
+				WillReturnRows(sqlmock.NewRows([]string{"project_id", "total_backups", "total_backups_size_gb"}))
+
+			exporter, err := NewCinderUsageExporter(db, test.availabilityZoneLabel)
+			if err != nil {
+				t.Fatalf("Failed to create NewCinderUsageExporter: %v", err)
+			}
+
+			if err := testutil.CollectAndCompare(exporter, strings.NewReader(test.expectedMetrics), "openstack_project_volumes", "openstack_project_volume_size_gb", "openstack_project_snapshots"); err != nil {
+				t.Errorf("unexpected collecting result:\n%s", err)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("There were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,245 @@
+package exporters
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Exporter is implemented by all usage exporters in this package.
+type Exporter interface {
+	prometheus.Collector
+	collectMetrics(ch chan<- prometheus.Metric) error
+}
+
+// queryError names the query that failed, which is used as the query label
+// of the per-query error counter.
+type queryError struct {
+	query string
+	err   error
+}
+
+func (e *queryError) Error() string {
+	return e.query + ": " + e.err.Error()
+}
+
+func (e *queryError) Unwrap() error {
+	return e.err
+}
+
+// failedQueries returns the names of all failed queries in err, which may
+// join the errors of several queries.
+func failedQueries(err error) []string {
+	var qe *queryError
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		var queries []string
+		for _, err := range joined.Unwrap() {
+			queries = append(queries, failedQueries(err)...)
+		}
+		return queries
+	} else if errors.As(err, &qe) {
+		return []string{qe.query}
+	}
+	return []string{"unknown"}
+}
+
+// Collector serves the metrics of an Exporter. Without an interval the
+// exporter queries the database on every scrape. With an interval the
+// exporter runs in the background and Collect serves the result of the last
+// successful run, so scrapes never hit the database.
+//
+// Success and duration of the last run and failed queries are exposed for
+// every exporter, so a collector broken by a schema change can be alerted on.
+type Collector struct {
+	name           string
+	exporter       Exporter
+	interval       time.Duration
+	lastCollection *prometheus.Desc
+	success        *prometheus.Desc
+	duration       *prometheus.Desc
+	queryErrors    *prometheus.CounterVec
+
+	mu               sync.RWMutex
+	metrics          []prometheus.Metric
+	lastSuccess      time.Time
+	lastRunSucceeded bool
+	lastDuration     time.Duration
+	hasRun           bool
+}
+
+// CollectorStatus describes the last run of a Collector.
+type CollectorStatus struct {
+	Name string
+	// HasRun is false until the first collection finished.
+	HasRun           bool
+	LastRunSucceeded bool
+	LastSuccess      time.Time
+	LastDuration     time.Duration
+}
+
+func NewCollector(name string, exporter Exporter, interval time.Duration) *Collector {
+	return &Collector{
+		name:     name,
+		exporter: exporter,
+		interval: interval,
+		lastCollection: prometheus.NewDesc(
+			"openstack_usage_exporter_last_collection_timestamp_seconds",
+			"Unix timestamp of the last successful collection",
+			nil, prometheus.Labels{"collector": name},
+		),
+		success: prometheus.NewDesc(
+			"openstack_usage_exporter_collector_success",
+			"Whether the last collection succeeded",
+			nil, prometheus.Labels{"collector": name},
+		),
+		duration: prometheus.NewDesc(
+			"openstack_usage_exporter_collector_duration_seconds",
+			"Duration of the last collection in seconds",
+			nil, prometheus.Labels{"collector": name},
+		),
+		queryErrors: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:        "openstack_usage_exporter_query_errors_total",
+				Help:        "Total number of failed database queries",
+				ConstLabels: prometheus.Labels{"collector": name},
+			},
+			[]string{"query"},
+		),
+	}
+}
+
+// Start runs the exporter in the background if an interval is configured.
+// The first run happens immediately.
+func (c *Collector) Start() {
+	if c.interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+
+		for {
+			c.refresh()
+			<-ticker.C
+		}
+	}()
+}
+
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	c.exporter.Describe(ch)
+	ch <- c.lastCollection
+	ch <- c.success
+	ch <- c.duration
+	c.queryErrors.Describe(ch)
+}
+
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	if c.interval <= 0 {
+		start := time.Now()
+		err := c.exporter.collectMetrics(ch)
+		c.recordRun(start, err)
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.interval > 0 {
+		for _, metric := range c.metrics {
+			ch <- metric
+		}
+	}
+
+	if !c.lastSuccess.IsZero() {
+		ch <- prometheus.MustNewConstMetric(
+			c.lastCollection,
+			prometheus.GaugeValue,
+			float64(c.lastSuccess.UnixNano())/1e9,
+		)
+	}
+
+	if c.hasRun {
+		success := 0.0
+		if c.lastRunSucceeded {
+			success = 1
+		}
+
+		ch <- prometheus.MustNewConstMetric(
+			c.success,
+			prometheus.GaugeValue,
+			success,
+		)
+
+		ch <- prometheus.MustNewConstMetric(
+			c.duration,
+			prometheus.GaugeValue,
+			c.lastDuration.Seconds(),
+		)
+	}
+
+	c.queryErrors.Collect(ch)
+}
+
+// Status returns the status of the last run of the exporter.
+func (c *Collector) Status() CollectorStatus {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return CollectorStatus{
+		Name:             c.name,
+		HasRun:           c.hasRun,
+		LastRunSucceeded: c.lastRunSucceeded,
+		LastSuccess:      c.lastSuccess,
+		LastDuration:     c.lastDuration,
+	}
+}
+
+func (c *Collector) refresh() {
+	ch := make(chan prometheus.Metric)
+	done := make(chan []prometheus.Metric)
+
+	go func() {
+		var metrics []prometheus.Metric
+		for metric := range ch {
+			metrics = append(metrics, metric)
+		}
+		done <- metrics
+	}()
+
+	start := time.Now()
+	err := c.exporter.collectMetrics(ch)
+	close(ch)
+	metrics := <-done
+
+	if err != nil {
+		log.Printf("Error collecting %s metrics, keeping previous result: %s", c.name, err)
+	} else {
+		c.mu.Lock()
+		c.metrics = metrics
+		c.mu.Unlock()
+	}
+
+	c.recordRun(start, err)
+}
+
+// recordRun updates the health metrics after a run of the exporter started at start.
+func (c *Collector) recordRun(start time.Time, err error) {
+	if err != nil {
+		for _, query := range failedQueries(err) {
+			c.queryErrors.WithLabelValues(query).Inc()
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.hasRun = true
+	c.lastRunSucceeded = err == nil
+	c.lastDuration = time.Since(start)
+	if err == nil {
+		c.lastSuccess = time.Now()
+	}
+}
@@ -0,0 +1,113 @@
+package exporters
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCollectorServesLastSuccessfulResult(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	rows := sqlmock.NewRows([]string{"project_id", "provider", "flavor", "topology", "total_lbs"}).
+		AddRow("c352b0ed-30ca-4634-9c2d-1947efc29096", "amphora", "", "SINGLE", 5)
+	mock.ExpectQuery("FROM load_balancer").WillReturnRows(rows)
+	for _, table := range []string{"listener", "pool", "member"} {
+		mock.ExpectQuery("FROM " + table).WillReturnRows(sqlmock.NewRows([]string{"project_id", "total"}))
+	}
+	mock.ExpectQuery("FROM load_balancer").WillReturnError(errors.New("connection refused"))
+
+	exporter, err := NewOctaviaUsageExporter(db)
+	if err != nil {
+		t.Fatalf("Failed to create NewOctaviaUsageExporter: %v", err)
+	}
+
+	collector := NewCollector("octavia", exporter, time.Minute)
+
+	if count := testutil.CollectAndCount(collector); count != 0 {
+		t.Errorf("expected no metrics before the first collection, got %d", count)
+	}
+	if status := collector.Status(); status.HasRun {
+		t.Errorf("expected no run before the first collection, got %+v", status)
+	}
+
+	expectedMetrics := `
+        # HELP openstack_project_load_balancers Total number of load balancers per OpenStack project, provider, flavor and topology
+        # TYPE openstack_project_load_balancers gauge
+        openstack_project_load_balancers{flavor="",project_id="c352b0ed-30ca-4634-9c2d-1947efc29096",provider="amphora",topology="SINGLE"} 5
+	`
+
+	// The failing second run must not replace the result of the first one.
+	collector.refresh()
+	collector.refresh()
+
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(expectedMetrics), "openstack_project_load_balancers"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+
+	expectedHealthMetrics := `
+        # HELP openstack_usage_exporter_collector_success Whether the last collection succeeded
+        # TYPE openstack_usage_exporter_collector_success gauge
+        openstack_usage_exporter_collector_success{collector="octavia"} 0
+        # HELP openstack_usage_exporter_query_errors_total Total number of failed database queries
+        # TYPE openstack_usage_exporter_query_errors_total counter
+        openstack_usage_exporter_query_errors_total{collector="octavia",query="load_balancers"} 1
+	`
+
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(expectedHealthMetrics), "openstack_usage_exporter_collector_success", "openstack_usage_exporter_query_errors_total"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+
+	if count := testutil.CollectAndCount(collector, "openstack_usage_exporter_last_collection_timestamp_seconds"); count != 1 {
+		t.Errorf("expected a last collection timestamp, got %d series", count)
+	}
+
+	if status := collector.Status(); !status.HasRun || status.LastRunSucceeded || status.LastSuccess.IsZero() {
+		t.Errorf("expected a failed run after a successful one, got %+v", status)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestFailedQueries(t *testing.T) {
+	err := errors.Join(
+		&queryError{query: "shares", err: errors.New("timeout")},
+		nil,
+		&queryError{query: "share_backups", err: errors.New("timeout")},
+	)
+
+	queries := failedQueries(err)
+	if len(queries) != 2 || queries[0] != "shares" || queries[1] != "share_backups" {
+		t.Errorf("unexpected failed queries: %v", queries)
+	}
+}
+
+func TestCollectorsCanBeRegisteredTogether(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	octavia, _ := NewOctaviaUsageExporter(db)
+	designate, _ := NewDesignateUsageExporter(db)
+
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(NewCollector("octavia", octavia, time.Minute)); err != nil {
+		t.Fatalf("Failed to register octavia collector: %v", err)
+	}
+	if err := registry.Register(NewCollector("designate", designate, time.Minute)); err != nil {
+		t.Errorf("Failed to register designate collector: %v", err)
+	}
+}
@@ -8,8 +8,10 @@ import (
 )
 
 type DesignateUsageExporter struct {
-	db        *sql.DB
-	zones     *prometheus.Desc
+	db         *sql.DB
+	zones      *prometheus.Desc
+	recordsets *prometheus.Desc
+	records    *prometheus.Desc
 }
 
 func NewDesignateUsageExporter(db *sql.DB) (*DesignateUsageExporter, error) {
@@ -17,7 +19,17 @@ func NewDesignateUsageExporter(db *sql.DB) (*DesignateUsageExporter, error) {
 		db: db,
 		zones: prometheus.NewDesc(
 			"openstack_project_dns_zones",
-			"Total number of dns zones per OpenStack project",
+			"Total number of dns zones per OpenStack project, zone type and status",
+			[]string{"project_id", "type", "status"}, nil,
+		),
+		recordsets: prometheus.NewDesc(
+			"openstack_project_dns_recordsets",
+			"Total number of dns recordsets per OpenStack project",
+			[]string{"project_id"}, nil,
+		),
+		records: prometheus.NewDesc(
+			"openstack_project_dns_records",
+			"Total number of dns records per OpenStack project",
 			[]string{"project_id"}, nil,
 		),
 	}, nil
@@ -25,30 +37,35 @@ func NewDesignateUsageExporter(db *sql.DB) (*DesignateUsageExporter, error) {
 
 func (e *DesignateUsageExporter) Describe(ch chan<- *prometheus.Desc) {
 	ch <- e.zones
+	ch <- e.recordsets
+	ch <- e.records
 }
 
 func (e *DesignateUsageExporter) Collect(ch chan<- prometheus.Metric) {
 	e.collectMetrics(ch)
 }
 
-func (e *DesignateUsageExporter) collectMetrics(ch chan<- prometheus.Metric) {
+func (e *DesignateUsageExporter) collectMetrics(ch chan<- prometheus.Metric) error {
+	// Deleted zones keep their row with deleted set to the zone id, live zones
+	// have deleted = '0'. Zones of the all-zero tenant are managed by Designate
+	// itself.
 	rows, err := e.db.Query(`
-		SELECT tenant_id, COUNT(id) AS total_zones
+		SELECT tenant_id, type, status, COUNT(id) AS total_zones
 		FROM zones
-		WHERE tenant_id != '00000000-0000-0000-0000-000000000000'
-		GROUP BY tenant_id
+		WHERE deleted = '0' AND tenant_id != '00000000-0000-0000-0000-000000000000'
+		GROUP BY tenant_id, type, status
 	`)
 
 	if err != nil {
 		log.Println("Error querying Designate database:", err)
-		return
+		return &queryError{query: "zones", err: err}
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		var projectID string
+		var projectID, zoneType, status string
 		var totalZones float64
-		if err := rows.Scan(&projectID, &totalZones); err != nil {
+		if err := rows.Scan(&projectID, &zoneType, &status, &totalZones); err != nil {
 			log.Println("Error scanning Designate row:", err)
 			continue
 		}
@@ -57,11 +74,62 @@ func (e *DesignateUsageExporter) collectMetrics(ch chan<- prometheus.Metric) {
 			e.zones,
 			prometheus.GaugeValue,
 			totalZones,
-			projectID,
+			projectID, zoneType, status,
 		)
 	}
 
 	if err := rows.Err(); err != nil {
 		log.Println("Error in Designate result set:", err)
+		return &queryError{query: "zones", err: err}
+	}
+
+	if err := e.collectZoneContents(ch, "recordsets", e.recordsets); err != nil {
+		return err
+	}
+	if err := e.collectZoneContents(ch, "records", e.records); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// collectZoneContents emits the number of rows in table belonging to the
+// zones of each project, which is also used as the query name.
+func (e *DesignateUsageExporter) collectZoneContents(ch chan<- prometheus.Metric, table string, desc *prometheus.Desc) error {
+	rows, err := e.db.Query(`
+		SELECT z.tenant_id, COUNT(t.id) AS total
+		FROM ` + table + ` t
+		INNER JOIN zones z ON t.zone_id = z.id
+		WHERE z.deleted = '0' AND z.tenant_id != '00000000-0000-0000-0000-000000000000'
+		GROUP BY z.tenant_id
+	`)
+
+	if err != nil {
+		log.Printf("Error querying Designate %s: %s", table, err)
+		return &queryError{query: table, err: err}
 	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var projectID string
+		var total float64
+		if err := rows.Scan(&projectID, &total); err != nil {
+			log.Printf("Error scanning Designate %s row: %s", table, err)
+			continue
+		}
+
+		ch <- prometheus.MustNewConstMetric(
+			desc,
+			prometheus.GaugeValue,
+			total,
+			projectID,
+		)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("Error in Designate %s result set: %s", table, err)
+		return &queryError{query: table, err: err}
+	}
+
+	return nil
 }
@@ -15,11 +15,21 @@ func TestDesignateUsageExporter(t *testing.T) {
 	}
 	defer db.Close()
 
-	rows := sqlmock.NewRows([]string{"tenant_id", "total_zones"}).
-		AddRow("c352b0ed-30ca-4634-9c2d-1947efc29096", 5).
-		AddRow("6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096", 3)
-
-	mock.ExpectQuery("SELECT tenant_id, COUNT").WillReturnRows(rows)
+	rows := sqlmock.NewRows([]string{"tenant_id", "type", "status", "total_zones"}).
+		AddRow("c352b0ed-30ca-4634-9c2d-1947efc29096", "PRIMARY", "ACTIVE", 4).
+		AddRow("c352b0ed-30ca-4634-9c2d-1947efc29096", "PRIMARY", "ERROR", 1).
+		AddRow("6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096", "SECONDARY", "ACTIVE", 3)
+
+	mock.ExpectQuery("SELECT tenant_id, type, status, COUNT\\(id\\) AS total_zones FROM zones WHERE deleted = '0'").WillReturnRows(rows)
+
+	mock.ExpectQuery("SELECT z.tenant_id, COUNT\\(t.id\\) AS total FROM recordsets t INNER JOIN zones z").WillReturnRows(
+		sqlmock.NewRows([]string{"tenant_id", "total"}).
+			AddRow("c352b0ed-30ca-4634-9c2d-1947efc29096", 20).
+			AddRow("6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096", 9))
+	mock.ExpectQuery("SELECT z.tenant_id, COUNT\\(t.id\\) AS total FROM records t INNER JOIN zones z").WillReturnRows(
+		sqlmock.NewRows([]string{"tenant_id", "total"}).
+			AddRow("c352b0ed-30ca-4634-9c2d-1947efc29096", 25).
+			AddRow("6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096", 12))
 
 	exporter, err := NewDesignateUsageExporter(db)
 	if err != nil {
@@ -27,10 +37,19 @@ func TestDesignateUsageExporter(t *testing.T) {
 	}
 
 	expectedMetrics := `
-        # HELP openstack_project_dns_zones Total number of dns zones per OpenStack project
+        # HELP openstack_project_dns_records Total number of dns records per OpenStack project
+        # TYPE openstack_project_dns_records gauge
+        openstack_project_dns_records{project_id="6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096"} 12
+        openstack_project_dns_records{project_id="c352b0ed-30ca-4634-9c2d-1947efc29096"} 25
+        # HELP openstack_project_dns_recordsets Total number of dns recordsets per OpenStack project
+        # TYPE openstack_project_dns_recordsets gauge
+        openstack_project_dns_recordsets{project_id="6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096"} 9
+        openstack_project_dns_recordsets{project_id="c352b0ed-30ca-4634-9c2d-1947efc29096"} 20
+        # HELP openstack_project_dns_zones Total number of dns zones per OpenStack project, zone type and status
         # TYPE openstack_project_dns_zones gauge
-        openstack_project_dns_zones{project_id="6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096"} 3
-        openstack_project_dns_zones{project_id="c352b0ed-30ca-4634-9c2d-1947efc29096"} 5
+        openstack_project_dns_zones{project_id="6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096",status="ACTIVE",type="SECONDARY"} 3
+        openstack_project_dns_zones{project_id="c352b0ed-30ca-4634-9c2d-1947efc29096",status="ACTIVE",type="PRIMARY"} 4
+        openstack_project_dns_zones{project_id="c352b0ed-30ca-4634-9c2d-1947efc29096",status="ERROR",type="PRIMARY"} 1
 	`
 
 	if err := testutil.CollectAndCompare(exporter, strings.NewReader(expectedMetrics)); err != nil {
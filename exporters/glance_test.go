@@ -0,0 +1,54 @@
+package exporters
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestGlanceUsageExporter(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	rows := sqlmock.NewRows([]string{"owner", "visibility", "disk_format", "total_images", "total_size_bytes"}).
+		AddRow("c352b0ed-30ca-4634-9c2d-1947efc29096", "public", "raw", 2, 4294967296).
+		AddRow("6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096", "private", "qcow2", 3, 1073741824).
+		AddRow("6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096", "shared", "raw", 1, 2147483648).
+		// Images without owner are stored with a NULL or an empty owner.
+		AddRow("", "public", "raw", 1, 1073741824).
+		AddRow("", "public", "raw", 2, 2147483648)
+	mock.ExpectQuery("SELECT COALESCE\\(owner, ''\\) AS owner, visibility.* GROUP BY 1, 2, 3").WillReturnRows(rows)
+
+	exporter, err := NewGlanceUsageExporter(db)
+	if err != nil {
+		t.Fatalf("Failed to create NewGlanceUsageExporter: %v", err)
+	}
+
+	expectedMetrics := `
+        # HELP openstack_project_images Total number of images per OpenStack project, visibility and disk format
+        # TYPE openstack_project_images gauge
+        openstack_project_images{disk_format="raw",project_id="",visibility="public"} 3
+        openstack_project_images{disk_format="qcow2",project_id="6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096",visibility="private"} 3
+        openstack_project_images{disk_format="raw",project_id="6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096",visibility="shared"} 1
+        openstack_project_images{disk_format="raw",project_id="c352b0ed-30ca-4634-9c2d-1947efc29096",visibility="public"} 2
+        # HELP openstack_project_images_size_bytes Total image size in bytes per OpenStack project, visibility and disk format
+        # TYPE openstack_project_images_size_bytes gauge
+        openstack_project_images_size_bytes{disk_format="raw",project_id="",visibility="public"} 3.221225472e+09
+        openstack_project_images_size_bytes{disk_format="qcow2",project_id="6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096",visibility="private"} 1.073741824e+09
+        openstack_project_images_size_bytes{disk_format="raw",project_id="6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096",visibility="shared"} 2.147483648e+09
+        openstack_project_images_size_bytes{disk_format="raw",project_id="c352b0ed-30ca-4634-9c2d-1947efc29096",visibility="public"} 4.294967296e+09
+	`
+
+	if err := testutil.CollectAndCompare(exporter, strings.NewReader(expectedMetrics)); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
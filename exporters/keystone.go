@@ -0,0 +1,110 @@
+package exporters
+
+import (
+	"database/sql"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type keystoneProject struct {
+	projectID   string
+	projectName string
+	domainID    string
+	domainName  string
+	parentID    string
+}
+
+// KeystoneProjectInfoExporter exposes the name, domain and parent of every
+// project as an info metric, which can be joined onto the usage metrics by
+// project_id. Projects rarely change, so the result is only reloaded from the
+// database once the refresh interval has passed.
+type KeystoneProjectInfoExporter struct {
+	db              *sql.DB
+	refreshInterval time.Duration
+	projectInfo     *prometheus.Desc
+
+	mu          sync.Mutex
+	lastRefresh time.Time
+	projects    []keystoneProject
+}
+
+func NewKeystoneProjectInfoExporter(db *sql.DB, refreshInterval time.Duration) (*KeystoneProjectInfoExporter, error) {
+	return &KeystoneProjectInfoExporter{
+		db:              db,
+		refreshInterval: refreshInterval,
+		projectInfo: prometheus.NewDesc(
+			"openstack_project_info",
+			"Name, domain and parent of an OpenStack project",
+			[]string{"project_id", "project_name", "domain_id", "domain_name", "parent_id"}, nil,
+		),
+	}, nil
+}
+
+func (e *KeystoneProjectInfoExporter) Describe(ch chan<- *prometheus.Desc) {
+	ch <- e.projectInfo
+}
+
+func (e *KeystoneProjectInfoExporter) Collect(ch chan<- prometheus.Metric) {
+	e.collectMetrics(ch)
+}
+
+func (e *KeystoneProjectInfoExporter) collectMetrics(ch chan<- prometheus.Metric) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var err error
+	if e.lastRefresh.IsZero() || time.Since(e.lastRefresh) >= e.refreshInterval {
+		// On failure the previously loaded projects are served until the next attempt.
+		var projects []keystoneProject
+		if projects, err = e.loadProjects(); err == nil {
+			e.projects = projects
+			e.lastRefresh = time.Now()
+		}
+	}
+
+	for _, project := range e.projects {
+		ch <- prometheus.MustNewConstMetric(
+			e.projectInfo,
+			prometheus.GaugeValue,
+			1,
+			project.projectID, project.projectName, project.domainID, project.domainName, project.parentID,
+		)
+	}
+
+	return err
+}
+
+func (e *KeystoneProjectInfoExporter) loadProjects() ([]keystoneProject, error) {
+	// Domains are stored in the project table as well, flagged by is_domain.
+	rows, err := e.db.Query(`
+		SELECT p.id, p.name, p.domain_id, COALESCE(d.name, '') AS domain_name, COALESCE(p.parent_id, '') AS parent_id
+		FROM project p
+		LEFT JOIN project d ON p.domain_id = d.id
+		WHERE p.is_domain = 0
+	`)
+	if err != nil {
+		log.Println("Error querying Keystone database:", err)
+		return nil, &queryError{query: "projects", err: err}
+	}
+	defer rows.Close()
+
+	var projects []keystoneProject
+	for rows.Next() {
+		var project keystoneProject
+		if err := rows.Scan(&project.projectID, &project.projectName, &project.domainID, &project.domainName, &project.parentID); err != nil {
+			log.Println("Error scanning Keystone row:", err)
+			continue
+		}
+		projects = append(projects, project)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Println("Error in Keystone result set:", err)
+		return nil, &queryError{query: "projects", err: err}
+	}
+
+	return projects, nil
+}
@@ -0,0 +1,46 @@
+package exporters
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestKeystoneProjectInfoExporter(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	rows := sqlmock.NewRows([]string{"id", "name", "domain_id", "domain_name", "parent_id"}).
+		AddRow("c352b0ed-30ca-4634-9c2d-1947efc29096", "billing", "default", "Default", "default").
+		AddRow("6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096", "web", "4d2ae6ad-1b4c-4f8e-9b1c-3f8c4c2e0a61", "customers", "c352b0ed-30ca-4634-9c2d-1947efc29096")
+	mock.ExpectQuery("SELECT p.id, p.name, p.domain_id").WillReturnRows(rows)
+
+	exporter, err := NewKeystoneProjectInfoExporter(db, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create NewKeystoneProjectInfoExporter: %v", err)
+	}
+
+	expectedMetrics := `
+        # HELP openstack_project_info Name, domain and parent of an OpenStack project
+        # TYPE openstack_project_info gauge
+        openstack_project_info{domain_id="4d2ae6ad-1b4c-4f8e-9b1c-3f8c4c2e0a61",domain_name="customers",parent_id="c352b0ed-30ca-4634-9c2d-1947efc29096",project_id="6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096",project_name="web"} 1
+        openstack_project_info{domain_id="default",domain_name="Default",parent_id="default",project_id="c352b0ed-30ca-4634-9c2d-1947efc29096",project_name="billing"} 1
+	`
+
+	// The second collection falls within the refresh interval and is served from the cache.
+	for i := 0; i < 2; i++ {
+		if err := testutil.CollectAndCompare(exporter, strings.NewReader(expectedMetrics)); err != nil {
+			t.Errorf("unexpected collecting result:\n%s", err)
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
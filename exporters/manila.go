@@ -2,25 +2,41 @@ package exporters
 
 import (
 	"database/sql"
+	"errors"
 	"log"
 
 	"github.com/prometheus/client_golang/prometheus"
 )
 
 type ManilaUsageExporter struct {
-	db                 *sql.DB
-	sharesSize         *prometheus.Desc
-	shareSnapshotsSize *prometheus.Desc
-	shareBackupsSize   *prometheus.Desc
+	db                    *sql.DB
+	availabilityZoneLabel bool
+	shares                *prometheus.Desc
+	sharesSize            *prometheus.Desc
+	shareSnapshotsSize    *prometheus.Desc
+	shareBackupsSize      *prometheus.Desc
 }
 
-func NewManilaUsageExporter(db *sql.DB) (*ManilaUsageExporter, error) {
+// NewManilaUsageExporter creates a Manila exporter. With
+// availabilityZoneLabel shares carry their availability zone.
+func NewManilaUsageExporter(db *sql.DB, availabilityZoneLabel bool) (*ManilaUsageExporter, error) {
+	shareLabels := []string{"project_id", "share_type", "share_proto"}
+	if availabilityZoneLabel {
+		shareLabels = append(shareLabels, "availability_zone")
+	}
+
 	return &ManilaUsageExporter{
-		db: db,
+		db:                    db,
+		availabilityZoneLabel: availabilityZoneLabel,
+		shares: prometheus.NewDesc(
+			"openstack_project_shares",
+			"Total number of shares per OpenStack project, share type and protocol",
+			shareLabels, nil,
+		),
 		sharesSize: prometheus.NewDesc(
 			"openstack_project_shares_size_gb",
-			"Total share size in GB per OpenStack project",
-			[]string{"project_id"}, nil,
+			"Total share size in GB per OpenStack project, share type and protocol",
+			shareLabels, nil,
 		),
 		shareSnapshotsSize: prometheus.NewDesc(
 			"openstack_project_share_snapshots_size_gb",
@@ -36,51 +52,90 @@ func NewManilaUsageExporter(db *sql.DB) (*ManilaUsageExporter, error) {
 }
 
 func (e *ManilaUsageExporter) Describe(ch chan<- *prometheus.Desc) {
+	ch <- e.shares
 	ch <- e.sharesSize
 	ch <- e.shareSnapshotsSize
 	ch <- e.shareBackupsSize
 }
 
 func (e *ManilaUsageExporter) Collect(ch chan<- prometheus.Metric) {
-	e.collectShareSize(ch)
-	e.collectShareSnapshotSize(ch)
-	e.collectShareBackupSize(ch)
+	e.collectMetrics(ch)
 }
 
-func (e *ManilaUsageExporter) collectShareSize(ch chan<- prometheus.Metric) {
-	rows, err := e.db.Query("SELECT project_id, SUM(size) AS shares_size FROM shares WHERE deleted='False' GROUP BY project_id")
+func (e *ManilaUsageExporter) collectMetrics(ch chan<- prometheus.Metric) error {
+	return errors.Join(
+		e.collectShareSize(ch),
+		e.collectShareSnapshotSize(ch),
+		e.collectShareBackupSize(ch),
+	)
+}
+
+func (e *ManilaUsageExporter) collectShareSize(ch chan<- prometheus.Metric) error {
+	// Share type and availability zone are stored per share instance. All
+	// instances of a share, i.e. its replicas, have the same type. Replicas may
+	// live in other zones, a replicated share is reported in one of them.
+	// Columns are grouped by position, see availabilityZoneColumn.
+	rows, err := e.db.Query(`
+		SELECT s.project_id, COALESCE(st.name, 'unknown') AS share_type, COALESCE(s.share_proto, 'unknown') AS share_proto, ` + availabilityZoneColumn(e.availabilityZoneLabel, "az.name") + ` AS availability_zone, COUNT(s.id) AS total_shares, SUM(s.size) AS shares_size
+		FROM shares s
+		LEFT JOIN (
+			SELECT share_id, MIN(share_type_id) AS share_type_id, MIN(availability_zone_id) AS availability_zone_id
+			FROM share_instances
+			WHERE deleted='False'
+			GROUP BY share_id
+		) si ON si.share_id = s.id
+		LEFT JOIN share_types st ON st.id = si.share_type_id
+		LEFT JOIN availability_zones az ON az.id = si.availability_zone_id
+		WHERE s.deleted='False'
+		GROUP BY 1, 2, 3, 4
+	`)
 	if err != nil {
 		log.Println("Error querying Manila database:", err)
-		return
+		return &queryError{query: "shares", err: err}
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		var projectID string
-		var sharesSize float64
-		if err := rows.Scan(&projectID, &sharesSize); err != nil {
+		var projectID, shareType, shareProto, availabilityZone string
+		var totalShares, sharesSize float64
+		if err := rows.Scan(&projectID, &shareType, &shareProto, &availabilityZone, &totalShares, &sharesSize); err != nil {
 			log.Println("Error scanning Manila row:", err)
 			continue
 		}
 
+		labelValues := []string{projectID, shareType, shareProto}
+		if e.availabilityZoneLabel {
+			labelValues = append(labelValues, availabilityZone)
+		}
+
+		ch <- prometheus.MustNewConstMetric(
+			e.shares,
+			prometheus.GaugeValue,
+			totalShares,
+			labelValues...,
+		)
+
 		ch <- prometheus.MustNewConstMetric(
 			e.sharesSize,
 			prometheus.GaugeValue,
 			sharesSize,
-			projectID,
+			labelValues...,
 		)
 
 	}
 	if err := rows.Err(); err != nil {
 		log.Println("Error in Manila result set:", err)
+		return &queryError{query: "shares", err: err}
 	}
+
+	return nil
 }
 
-func (e *ManilaUsageExporter) collectShareSnapshotSize(ch chan<- prometheus.Metric) {
+func (e *ManilaUsageExporter) collectShareSnapshotSize(ch chan<- prometheus.Metric) error {
 	rows, err := e.db.Query("SELECT project_id, SUM(size) AS share_snapshots_size FROM share_snapshots WHERE deleted='False' GROUP BY project_id")
 	if err != nil {
 		log.Println("Error querying Manila database:", err)
-		return
+		return &queryError{query: "share_snapshots", err: err}
 	}
 	defer rows.Close()
 
@@ -102,14 +157,17 @@ func (e *ManilaUsageExporter) collectShareSnapshotSize(ch chan<- prometheus.Metr
 	}
 	if err := rows.Err(); err != nil {
 		log.Println("Error in Manila result set:", err)
+		return &queryError{query: "share_snapshots", err: err}
 	}
+
+	return nil
 }
 
-func (e *ManilaUsageExporter) collectShareBackupSize(ch chan<- prometheus.Metric) {
+func (e *ManilaUsageExporter) collectShareBackupSize(ch chan<- prometheus.Metric) error {
 	rows, err := e.db.Query("SELECT project_id, SUM(size) AS share_backups_size FROM share_backups WHERE deleted='False' GROUP BY project_id")
 	if err != nil {
 		log.Println("Error querying Manila database:", err)
-		return
+		return &queryError{query: "share_backups", err: err}
 	}
 	defer rows.Close()
 
@@ -131,5 +189,8 @@ func (e *ManilaUsageExporter) collectShareBackupSize(ch chan<- prometheus.Metric
 	}
 	if err := rows.Err(); err != nil {
 		log.Println("Error in Manila result set:", err)
+		return &queryError{query: "share_backups", err: err}
 	}
+
+	return nil
 }
@@ -16,10 +16,11 @@ func TestManilaUsageExporter(t *testing.T) {
 	defer db.Close()
 
 	sharesRows := sqlmock.NewRows([]string{
-		"project_id", "shares_size"}).
-		AddRow("6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096", 2).
-		AddRow("c352b0ed-30ca-4634-9c2d-1947efc29096", 12)
-	mock.ExpectQuery("SELECT project_id, SUM\\(size\\) AS shares_size FROM shares").WillReturnRows(sharesRows)
+		"project_id", "share_type", "share_proto", "availability_zone", "total_shares", "shares_size"}).
+		AddRow("6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096", "default", "NFS", "", 1, 2).
+		AddRow("c352b0ed-30ca-4634-9c2d-1947efc29096", "default", "NFS", "", 2, 4).
+		AddRow("c352b0ed-30ca-4634-9c2d-1947efc29096", "cephfs", "CEPHFS", "", 1, 8)
+	mock.ExpectQuery("SELECT s.project_id, .* FROM shares s LEFT JOIN \\( SELECT share_id, MIN\\(share_type_id\\) AS share_type_id, MIN\\(availability_zone_id\\) AS availability_zone_id FROM share_instances").WillReturnRows(sharesRows)
 
 	shareSnapshotsRows := sqlmock.NewRows([]string{
 		"project_id", "shares_size"}).
@@ -33,7 +34,7 @@ func TestManilaUsageExporter(t *testing.T) {
 		AddRow("c352b0ed-30ca-4634-9c2d-1947efc29096", 0)
 	mock.ExpectQuery("SELECT project_id, SUM\\(size\\) AS share_backups_size FROM share_backups").WillReturnRows(shareBackupsRows)
 
-	exporter, err := NewManilaUsageExporter(db)
+	exporter, err := NewManilaUsageExporter(db, false)
 	if err != nil {
 		t.Fatalf("Failed to create ManilaUsageExporter: %v", err)
 	}
@@ -47,10 +48,16 @@ func TestManilaUsageExporter(t *testing.T) {
         # TYPE openstack_project_share_snapshots_size_gb gauge
         openstack_project_share_snapshots_size_gb{project_id="6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096"} 4
         openstack_project_share_snapshots_size_gb{project_id="c352b0ed-30ca-4634-9c2d-1947efc29096"} 24
-        # HELP openstack_project_shares_size_gb Total share size in GB per OpenStack project
+        # HELP openstack_project_shares Total number of shares per OpenStack project, share type and protocol
+        # TYPE openstack_project_shares gauge
+        openstack_project_shares{project_id="6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096",share_proto="NFS",share_type="default"} 1
+        openstack_project_shares{project_id="c352b0ed-30ca-4634-9c2d-1947efc29096",share_proto="CEPHFS",share_type="cephfs"} 1
+        openstack_project_shares{project_id="c352b0ed-30ca-4634-9c2d-1947efc29096",share_proto="NFS",share_type="default"} 2
+        # HELP openstack_project_shares_size_gb Total share size in GB per OpenStack project, share type and protocol
         # TYPE openstack_project_shares_size_gb gauge
-        openstack_project_shares_size_gb{project_id="6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096"} 2
-        openstack_project_shares_size_gb{project_id="c352b0ed-30ca-4634-9c2d-1947efc29096"} 12
+        openstack_project_shares_size_gb{project_id="6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096",share_proto="NFS",share_type="default"} 2
+        openstack_project_shares_size_gb{project_id="c352b0ed-30ca-4634-9c2d-1947efc29096",share_proto="CEPHFS",share_type="cephfs"} 8
+        openstack_project_shares_size_gb{project_id="c352b0ed-30ca-4634-9c2d-1947efc29096",share_proto="NFS",share_type="default"} 4
 	`
 
 	if err := testutil.CollectAndCompare(exporter, strings.NewReader(expectedMetrics)); err != nil {
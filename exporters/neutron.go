@@ -3,30 +3,46 @@ package exporters
 import (
 	"database/sql"
 	"log"
+	"strconv"
+	"strings"
 
 	"github.com/prometheus/client_golang/prometheus"
 )
 
 type NeutronUsageExporter struct {
-	db                *sql.DB
-	externalNetworkId string
-	floatingIPs       *prometheus.Desc
-	routers           *prometheus.Desc
+	db                 *sql.DB
+	externalNetworkIds []string
+	floatingIPs        *prometheus.Desc
+	routers            *prometheus.Desc
 }
 
-func NewNeutronUsageExporter(db *sql.DB, externalNetworkId string) (*NeutronUsageExporter, error) {
+type neutronNetworkKey struct {
+	projectID string
+	networkID string
+}
+
+type neutronFloatingIPKey struct {
+	projectID  string
+	networkID  string
+	associated string
+}
+
+// NewNeutronUsageExporter creates a Neutron exporter. Only routers with a
+// gateway on one of the given external networks are counted. Without any
+// network ids, all networks marked as external are used.
+func NewNeutronUsageExporter(db *sql.DB, externalNetworkIds []string) (*NeutronUsageExporter, error) {
 	return &NeutronUsageExporter{
-		db:                db,
-		externalNetworkId: externalNetworkId,
+		db:                 db,
+		externalNetworkIds: externalNetworkIds,
 		floatingIPs: prometheus.NewDesc(
 			"openstack_project_floating_ips",
-			"Total number of floating IPs per OpenStack project",
-			[]string{"project_id"}, nil,
+			"Total number of floating IPs per OpenStack project and floating network, by whether they are associated with a port",
+			[]string{"project_id", "network_id", "associated"}, nil,
 		),
 		routers: prometheus.NewDesc(
 			"openstack_project_routers",
-			"Total number of routers per OpenStack project",
-			[]string{"project_id"}, nil,
+			"Total number of routers per OpenStack project and external network",
+			[]string{"project_id", "network_id"}, nil,
 		),
 	}, nil
 }
@@ -40,77 +56,82 @@ func (e *NeutronUsageExporter) Collect(ch chan<- prometheus.Metric) {
 	e.collectMetrics(ch)
 }
 
-func (e *NeutronUsageExporter) collectMetrics(ch chan<- prometheus.Metric) {
-	floatingIPsCounts := make(map[string]float64)
-	rows, err := e.db.Query("SELECT project_id, COUNT(id) AS total_fips FROM floatingips GROUP BY project_id")
+func (e *NeutronUsageExporter) collectMetrics(ch chan<- prometheus.Metric) error {
+	// Floating IPs without a fixed port are allocated but idle.
+	floatingIPsCounts := make(map[neutronFloatingIPKey]float64)
+	rows, err := e.db.Query("SELECT project_id, floating_network_id, fixed_port_id IS NOT NULL AS associated, COUNT(id) AS total_fips FROM floatingips GROUP BY project_id, floating_network_id, associated")
 	if err != nil {
 		log.Println("Error querying floating IP counts:", err)
-		return
+		return &queryError{query: "floating_ips", err: err}
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		var projectID string
+		var projectID, networkID string
+		var associated bool
 		var totalFloatingIPs float64
-		if err := rows.Scan(&projectID, &totalFloatingIPs); err != nil {
+		if err := rows.Scan(&projectID, &networkID, &associated, &totalFloatingIPs); err != nil {
 			log.Println("Error scanning floating IP row:", err)
 			continue
 		}
-		floatingIPsCounts[projectID] = totalFloatingIPs
+		floatingIPsCounts[neutronFloatingIPKey{projectID, networkID, strconv.FormatBool(associated)}] = totalFloatingIPs
 	}
 
 	if err := rows.Err(); err != nil {
 		log.Println("Error in floating IPs result set:", err)
-		return
+		return &queryError{query: "floating_ips", err: err}
 	}
 
-	routerCounts := make(map[string]float64)
-	rows, err = e.db.Query("SELECT r.project_id, COUNT(r.id) AS total_routers FROM routers r INNER JOIN ports p ON r.gw_port_id = p.id WHERE p.network_id = ? GROUP BY r.project_id", e.externalNetworkId)
+	routerCounts := make(map[neutronNetworkKey]float64)
+	if len(e.externalNetworkIds) > 0 {
+		networkIds := make([]any, len(e.externalNetworkIds))
+		for i, networkId := range e.externalNetworkIds {
+			networkIds[i] = networkId
+		}
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(networkIds)), ", ")
+
+		rows, err = e.db.Query("SELECT r.project_id, p.network_id, COUNT(r.id) AS total_routers FROM routers r INNER JOIN ports p ON r.gw_port_id = p.id WHERE p.network_id IN ("+placeholders+") GROUP BY r.project_id, p.network_id", networkIds...)
+	} else {
+		rows, err = e.db.Query("SELECT r.project_id, p.network_id, COUNT(r.id) AS total_routers FROM routers r INNER JOIN ports p ON r.gw_port_id = p.id INNER JOIN externalnetworks en ON p.network_id = en.network_id GROUP BY r.project_id, p.network_id")
+	}
 	if err != nil {
 		log.Println("Error querying router counts:", err)
-		return
+		return &queryError{query: "routers", err: err}
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		var projectID string
+		var projectID, networkID string
 		var totalRouters float64
-		if err := rows.Scan(&projectID, &totalRouters); err != nil {
+		if err := rows.Scan(&projectID, &networkID, &totalRouters); err != nil {
 			log.Println("Error scanning router row:", err)
 			continue
 		}
-		routerCounts[projectID] = totalRouters
+		routerCounts[neutronNetworkKey{projectID, networkID}] = totalRouters
 	}
 
 	if err := rows.Err(); err != nil {
 		log.Println("Error in routers result set:", err)
-		return
+		return &queryError{query: "routers", err: err}
 	}
 
-	projectIDs := make(map[string]bool)
-	for projectID := range floatingIPsCounts {
-		projectIDs[projectID] = true
-	}
-	for projectID := range routerCounts {
-		projectIDs[projectID] = true
-	}
-
-	for projectID := range projectIDs {
-		totalFloatingIPs := floatingIPsCounts[projectID]
-		totalRouters := routerCounts[projectID]
-
+	for key, totalFloatingIPs := range floatingIPsCounts {
 		ch <- prometheus.MustNewConstMetric(
 			e.floatingIPs,
 			prometheus.GaugeValue,
 			totalFloatingIPs,
-			projectID,
+			key.projectID, key.networkID, key.associated,
 		)
+	}
 
+	for key, totalRouters := range routerCounts {
 		ch <- prometheus.MustNewConstMetric(
 			e.routers,
 			prometheus.GaugeValue,
 			totalRouters,
-			projectID,
+			key.projectID, key.networkID,
 		)
 	}
+
+	return nil
 }
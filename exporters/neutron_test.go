@@ -15,30 +15,72 @@ func TestNeutronUsageExporter(t *testing.T) {
 	}
 	defer db.Close()
 
-	floatingIPRows := sqlmock.NewRows([]string{"project_id", "total_fips"}).
-		AddRow("c352b0ed-30ca-4634-9c2d-1947efc29096", 2).
-		AddRow("6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096", 3)
-	mock.ExpectQuery("SELECT project_id, COUNT\\(id\\) AS total_fips FROM floatingips GROUP BY project_id").WillReturnRows(floatingIPRows)
+	floatingIPRows := sqlmock.NewRows([]string{"project_id", "floating_network_id", "associated", "total_fips"}).
+		AddRow("c352b0ed-30ca-4634-9c2d-1947efc29096", "5d8722dd-186c-4e32-a170-b216a04688dc", true, 2).
+		AddRow("6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096", "5d8722dd-186c-4e32-a170-b216a04688dc", true, 2).
+		AddRow("6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096", "5d8722dd-186c-4e32-a170-b216a04688dc", false, 1).
+		AddRow("6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096", "9a0d2f0e-3b1c-4c55-8d0e-2f6a7c1b9e44", false, 1)
+	mock.ExpectQuery("SELECT project_id, floating_network_id, fixed_port_id IS NOT NULL AS associated, COUNT\\(id\\) AS total_fips FROM floatingips GROUP BY project_id, floating_network_id, associated").WillReturnRows(floatingIPRows)
 
-	routerRows := sqlmock.NewRows([]string{"project_id", "total_routers"}).
-		AddRow("c352b0ed-30ca-4634-9c2d-1947efc29096", 1).
-		AddRow("6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096", 2)
-	mock.ExpectQuery("SELECT r.project_id, COUNT\\(r.id\\) AS total_routers FROM routers r").WithArgs("5d8722dd-186c-4e32-a170-b216a04688dc").WillReturnRows(routerRows)
+	routerRows := sqlmock.NewRows([]string{"project_id", "network_id", "total_routers"}).
+		AddRow("c352b0ed-30ca-4634-9c2d-1947efc29096", "5d8722dd-186c-4e32-a170-b216a04688dc", 1).
+		AddRow("6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096", "5d8722dd-186c-4e32-a170-b216a04688dc", 2).
+		AddRow("6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096", "9a0d2f0e-3b1c-4c55-8d0e-2f6a7c1b9e44", 1)
+	mock.ExpectQuery("SELECT r.project_id, p.network_id, COUNT\\(r.id\\) AS total_routers FROM routers r .* WHERE p.network_id IN \\(\\?, \\?\\)").
+		WithArgs("5d8722dd-186c-4e32-a170-b216a04688dc", "9a0d2f0e-3b1c-4c55-8d0e-2f6a7c1b9e44").
+		WillReturnRows(routerRows)
 
-	exporter, err := NewNeutronUsageExporter(db, "5d8722dd-186c-4e32-a170-b216a04688dc")
+	exporter, err := NewNeutronUsageExporter(db, []string{"5d8722dd-186c-4e32-a170-b216a04688dc", "9a0d2f0e-3b1c-4c55-8d0e-2f6a7c1b9e44"})
 	if err != nil {
 		t.Fatalf("Failed to create NeutronUsageExporter: %v", err)
 	}
 
 	expectedMetrics := `
-        # HELP openstack_project_floating_ips Total number of floating IPs per OpenStack project
+        # HELP openstack_project_floating_ips Total number of floating IPs per OpenStack project and floating network, by whether they are associated with a port
         # TYPE openstack_project_floating_ips gauge
-        openstack_project_floating_ips{project_id="6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096"} 3
-        openstack_project_floating_ips{project_id="c352b0ed-30ca-4634-9c2d-1947efc29096"} 2
-        # HELP openstack_project_routers Total number of routers per OpenStack project
+        openstack_project_floating_ips{associated="false",network_id="5d8722dd-186c-4e32-a170-b216a04688dc",project_id="6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096"} 1
+        openstack_project_floating_ips{associated="true",network_id="5d8722dd-186c-4e32-a170-b216a04688dc",project_id="6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096"} 2
+        openstack_project_floating_ips{associated="true",network_id="5d8722dd-186c-4e32-a170-b216a04688dc",project_id="c352b0ed-30ca-4634-9c2d-1947efc29096"} 2
+        openstack_project_floating_ips{associated="false",network_id="9a0d2f0e-3b1c-4c55-8d0e-2f6a7c1b9e44",project_id="6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096"} 1
+        # HELP openstack_project_routers Total number of routers per OpenStack project and external network
         # TYPE openstack_project_routers gauge
-        openstack_project_routers{project_id="6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096"} 2
-        openstack_project_routers{project_id="c352b0ed-30ca-4634-9c2d-1947efc29096"} 1
+        openstack_project_routers{network_id="5d8722dd-186c-4e32-a170-b216a04688dc",project_id="6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096"} 2
+        openstack_project_routers{network_id="5d8722dd-186c-4e32-a170-b216a04688dc",project_id="c352b0ed-30ca-4634-9c2d-1947efc29096"} 1
+        openstack_project_routers{network_id="9a0d2f0e-3b1c-4c55-8d0e-2f6a7c1b9e44",project_id="6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096"} 1
+	`
+
+	if err := testutil.CollectAndCompare(exporter, strings.NewReader(expectedMetrics)); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestNeutronUsageExporterDetectsExternalNetworks(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT project_id, floating_network_id").WillReturnRows(
+		sqlmock.NewRows([]string{"project_id", "floating_network_id", "associated", "total_fips"}))
+
+	routerRows := sqlmock.NewRows([]string{"project_id", "network_id", "total_routers"}).
+		AddRow("c352b0ed-30ca-4634-9c2d-1947efc29096", "5d8722dd-186c-4e32-a170-b216a04688dc", 1)
+	mock.ExpectQuery("INNER JOIN externalnetworks en ON p.network_id = en.network_id").WillReturnRows(routerRows)
+
+	exporter, err := NewNeutronUsageExporter(db, nil)
+	if err != nil {
+		t.Fatalf("Failed to create NeutronUsageExporter: %v", err)
+	}
+
+	expectedMetrics := `
+        # HELP openstack_project_routers Total number of routers per OpenStack project and external network
+        # TYPE openstack_project_routers gauge
+        openstack_project_routers{network_id="5d8722dd-186c-4e32-a170-b216a04688dc",project_id="c352b0ed-30ca-4634-9c2d-1947efc29096"} 1
 	`
 
 	if err := testutil.CollectAndCompare(exporter, strings.NewReader(expectedMetrics)); err != nil {
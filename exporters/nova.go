@@ -2,89 +2,548 @@ package exporters
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
 	"log"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
 
 	"github.com/prometheus/client_golang/prometheus"
 )
 
+// NovaCell is the database of a Nova cells v2 cell.
+type NovaCell struct {
+	Name string
+	DB   *sql.DB
+}
+
+// NovaCells provides the cells an exporter reads from.
+type NovaCells interface {
+	Cells() ([]NovaCell, error)
+}
+
+// StaticNovaCells is a fixed list of cells.
+type StaticNovaCells []NovaCell
+
+func (c StaticNovaCells) Cells() ([]NovaCell, error) {
+	return c, nil
+}
+
+// NovaCellDatabase is the database of a cell as registered in nova_api.
+type NovaCellDatabase struct {
+	// Address is the host and port of the database server, empty if the
+	// connection names no host, i.e. the cell uses the database server of
+	// nova_api.
+	Address  string
+	Database string
+}
+
+func (d NovaCellDatabase) String() string {
+	if d.Address == "" {
+		return d.Database
+	}
+	return d.Address + "/" + d.Database
+}
+
+// NovaCellDiscovery discovers the cells from the nova_api database every time
+// they are requested, so cells added later are picked up without a restart.
+// The database of a cell is opened when the cell is first seen and kept open
+// afterwards.
+type NovaCellDiscovery struct {
+	apiDB        *sql.DB
+	cellDSN      func(database NovaCellDatabase) (string, error)
+	openDatabase func(name, dsn string) (*sql.DB, error)
+
+	mu sync.Mutex
+	// databases holds the opened cell databases by DSN, as cells on
+	// different database servers may use the same database name.
+	databases map[string]*sql.DB
+}
+
+// NewNovaCellDiscovery creates a cell discovery reading the cell_mappings from
+// apiDB. cellDSN returns the DSN of a cell database, which openDatabase opens.
+func NewNovaCellDiscovery(apiDB *sql.DB, cellDSN func(database NovaCellDatabase) (string, error), openDatabase func(name, dsn string) (*sql.DB, error)) *NovaCellDiscovery {
+	return &NovaCellDiscovery{
+		apiDB:        apiDB,
+		cellDSN:      cellDSN,
+		openDatabase: openDatabase,
+		databases:    make(map[string]*sql.DB),
+	}
+}
+
+// Cells returns the discovered cells. Cells whose database cannot be opened
+// are skipped and reported in the error together with the other cells.
+func (d *NovaCellDiscovery) Cells() ([]NovaCell, error) {
+	cellDatabases, err := DiscoverNovaCells(d.apiDB)
+	if err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var cells []NovaCell
+	var errs []error
+	for name, database := range cellDatabases {
+		db, err := d.open(database)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("cell %s: %w", name, err))
+			continue
+		}
+		cells = append(cells, NovaCell{Name: name, DB: db})
+	}
+	sort.Slice(cells, func(i, j int) bool {
+		return cells[i].Name < cells[j].Name
+	})
+
+	return cells, errors.Join(errs...)
+}
+
+func (d *NovaCellDiscovery) open(database NovaCellDatabase) (*sql.DB, error) {
+	dsn, err := d.cellDSN(database)
+	if err != nil {
+		return nil, err
+	}
+
+	db, exists := d.databases[dsn]
+	if !exists {
+		if db, err = d.openDatabase(database.String(), dsn); err != nil {
+			return nil, err
+		}
+		d.databases[dsn] = db
+	}
+	return db, nil
+}
+
 type NovaUsageExporter struct {
-	db     				*sql.DB
-	vcpus  				*prometheus.Desc
-	ram_mb 				*prometheus.Desc
-	local_storage_gb	*prometheus.Desc
+	cells                 NovaCells
+	cellLabel             bool
+	availabilityZoneLabel bool
+	vcpus                 *prometheus.Desc
+	ram_mb                *prometheus.Desc
+	local_storage_gb      *prometheus.Desc
+	instances             *prometheus.Desc
+	instancesByState      *prometheus.Desc
+	vcpusByState          *prometheus.Desc
+	ramMBByState          *prometheus.Desc
+	localStorageByState   *prometheus.Desc
+}
+
+type novaProjectKey struct {
+	projectID        string
+	availabilityZone string
+	cell             string
+}
+
+type novaFlavorKey struct {
+	projectID        string
+	flavor           string
+	availabilityZone string
+	cell             string
+}
+
+type novaStateKey struct {
+	projectID        string
+	vmState          string
+	availabilityZone string
+	cell             string
+}
+
+type novaUsage struct {
+	instances      float64
+	vcpus          float64
+	ramMB          float64
+	localStorageGB float64
 }
 
 func NewNovaUsageExporter(db *sql.DB) (*NovaUsageExporter, error) {
+	return NewNovaCellsUsageExporter(StaticNovaCells{{DB: db}}, false, false)
+}
+
+// NewNovaCellsUsageExporter creates a Nova exporter reading the instances of
+// all cells, which are requested again on every collection. Usage is summed
+// up across cells unless cellLabel is set, in which case every metric carries
+// the name of its cell. With availabilityZoneLabel every metric carries the
+// availability zone of the instances.
+func NewNovaCellsUsageExporter(cells NovaCells, cellLabel bool, availabilityZoneLabel bool) (*NovaUsageExporter, error) {
+	labels := []string{"project_id"}
+	flavorLabels := []string{"project_id", "flavor"}
+	stateLabels := []string{"project_id", "vm_state"}
+	if availabilityZoneLabel {
+		labels = append(labels, "availability_zone")
+		flavorLabels = append(flavorLabels, "availability_zone")
+		stateLabels = append(stateLabels, "availability_zone")
+	}
+	if cellLabel {
+		labels = append(labels, "cell")
+		flavorLabels = append(flavorLabels, "cell")
+		stateLabels = append(stateLabels, "cell")
+	}
+
 	return &NovaUsageExporter{
-		db: db,
+		cells:                 cells,
+		cellLabel:             cellLabel,
+		availabilityZoneLabel: availabilityZoneLabel,
 		vcpus: prometheus.NewDesc(
 			"openstack_project_vcpus",
 			"Total number of vcpus per OpenStack project",
-			[]string{"project_id"}, nil,
+			labels, nil,
 		),
 		ram_mb: prometheus.NewDesc(
 			"openstack_project_ram_mb",
 			"Total ram usage in MB per OpenStack project",
-			[]string{"project_id"}, nil,
+			labels, nil,
 		),
 		local_storage_gb: prometheus.NewDesc(
 			"openstack_project_local_storage_gb",
 			"Total local storage usage in GB per OpenStack project",
-			[]string{"project_id"}, nil,
+			labels, nil,
+		),
+		instances: prometheus.NewDesc(
+			"openstack_project_instances",
+			"Total number of running instances per OpenStack project and flavor",
+			flavorLabels, nil,
+		),
+		instancesByState: prometheus.NewDesc(
+			"openstack_project_instances_by_vm_state",
+			"Total number of instances per OpenStack project and vm state",
+			stateLabels, nil,
+		),
+		vcpusByState: prometheus.NewDesc(
+			"openstack_project_vcpus_by_vm_state",
+			"Total number of vcpus per OpenStack project and vm state",
+			stateLabels, nil,
+		),
+		ramMBByState: prometheus.NewDesc(
+			"openstack_project_ram_mb_by_vm_state",
+			"Total ram usage in MB per OpenStack project and vm state",
+			stateLabels, nil,
+		),
+		localStorageByState: prometheus.NewDesc(
+			"openstack_project_local_storage_gb_by_vm_state",
+			"Total local storage usage in GB per OpenStack project and vm state",
+			stateLabels, nil,
 		),
 	}, nil
 }
 
+// novaConnectionTemplate replaces the variables Nova substitutes in templated
+// cell database connections with values of the API database connection, such
+// as {scheme}://{username}:{password}@{hostname}/nova_cell1, so that the
+// connection can be parsed. {hostname} and {port} are removed, as the cell
+// then uses the database server of nova_api. {path} is kept, as the database
+// name cannot be known from it.
+var novaConnectionTemplate = strings.NewReplacer(
+	"{scheme}", "mysql",
+	"{username}", "nova",
+	"{password}", "nova",
+	"{hostname}", "",
+	"{port}", "",
+	"{query}", "",
+	"{fragment}", "",
+)
+
+// DiscoverNovaCells returns the databases of all cells registered in the
+// nova_api database, keyed by cell name. cell0 only holds instances that
+// failed to schedule and is skipped.
+func DiscoverNovaCells(apiDB *sql.DB) (map[string]NovaCellDatabase, error) {
+	rows, err := apiDB.Query("SELECT COALESCE(name, uuid) AS name, database_connection FROM cell_mappings WHERE uuid != '00000000-0000-0000-0000-000000000000'")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cells := make(map[string]NovaCellDatabase)
+	for rows.Next() {
+		var name, connection string
+		if err := rows.Scan(&name, &connection); err != nil {
+			return nil, err
+		}
+
+		database, err := novaCellDatabase(connection)
+		if err != nil {
+			return nil, fmt.Errorf("cell %s: %w", name, err)
+		}
+		cells[name] = database
+	}
+
+	return cells, rows.Err()
+}
+
+// novaCellDatabase returns the database server and name of a cell database
+// connection, e.g. mysql+pymysql://nova:secret@db/nova_cell1?charset=utf8.
+func novaCellDatabase(connection string) (NovaCellDatabase, error) {
+	connectionURL, err := url.Parse(novaConnectionTemplate.Replace(connection))
+	if err != nil {
+		// The error of url.Parse contains the connection including its password.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return NovaCellDatabase{}, fmt.Errorf("invalid database connection: %w", err)
+	}
+
+	database := strings.TrimPrefix(connectionURL.Path, "/")
+	if database == "" || strings.ContainsAny(database, "{}") {
+		return NovaCellDatabase{}, errors.New("database connection does not name the database")
+	}
+
+	address := connectionURL.Hostname()
+	if address != "" && connectionURL.Port() != "" {
+		address = net.JoinHostPort(address, connectionURL.Port())
+	}
+	return NovaCellDatabase{Address: address, Database: database}, nil
+}
+
 func (e *NovaUsageExporter) Describe(ch chan<- *prometheus.Desc) {
 	ch <- e.vcpus
 	ch <- e.ram_mb
 	ch <- e.local_storage_gb
+	ch <- e.instances
+	ch <- e.instancesByState
+	ch <- e.vcpusByState
+	ch <- e.ramMBByState
+	ch <- e.localStorageByState
 }
 
 func (e *NovaUsageExporter) Collect(ch chan<- prometheus.Metric) {
 	e.collectMetrics(ch)
 }
 
-func (e *NovaUsageExporter) collectMetrics(ch chan<- prometheus.Metric) {
-	rows, err := e.db.Query("SELECT project_id, SUM(vcpus) AS total_vcpus, SUM(memory_mb) AS total_ram_mb, SUM(root_gb) as total_root_gb FROM instances WHERE deleted = 0 GROUP BY project_id")
+func (e *NovaUsageExporter) collectMetrics(ch chan<- prometheus.Metric) error {
+	usage := make(map[novaProjectKey]*novaUsage)
+	flavors := make(map[novaFlavorKey]float64)
+	states := make(map[novaStateKey]*novaUsage)
+
+	// A failing cell does not keep the other cells from being exported, its
+	// errors are reported together.
+	var errs []error
+	cells, err := e.cells.Cells()
 	if err != nil {
-		log.Println("Error querying Nova database:", err)
-		return
+		log.Println("Error discovering Nova cells:", err)
+		errs = append(errs, &queryError{query: "cell_mappings", err: err})
 	}
-	defer rows.Close()
 
-	for rows.Next() {
-		var projectID string
-		var totalVcpus float64
-		var totalRamMB float64
-		var totalLocalStorageGB float64
-		if err := rows.Scan(&projectID, &totalVcpus, &totalRamMB, &totalLocalStorageGB); err != nil {
-			log.Println("Error scanning Nova row:", err)
-			continue
+	for _, cell := range cells {
+		cellName := ""
+		if e.cellLabel {
+			cellName = cell.Name
 		}
 
+		errs = append(errs,
+			cellError(cell.Name, e.collectCellUsage(cell.DB, cellName, usage)),
+			cellError(cell.Name, e.collectCellFlavors(cell.DB, cellName, flavors)),
+			cellError(cell.Name, e.collectCellStates(cell.DB, cellName, states)),
+		)
+	}
+
+	for key, projectUsage := range usage {
+		labelValues := e.labelValues([]string{key.projectID}, key.availabilityZone, key.cell)
+
 		ch <- prometheus.MustNewConstMetric(
 			e.vcpus,
 			prometheus.GaugeValue,
-			totalVcpus,
-			projectID,
+			projectUsage.vcpus,
+			labelValues...,
 		)
 
 		ch <- prometheus.MustNewConstMetric(
 			e.ram_mb,
 			prometheus.GaugeValue,
-			totalRamMB,
-			projectID,
+			projectUsage.ramMB,
+			labelValues...,
 		)
 
 		ch <- prometheus.MustNewConstMetric(
 			e.local_storage_gb,
 			prometheus.GaugeValue,
-			totalLocalStorageGB,
-			projectID,
+			projectUsage.localStorageGB,
+			labelValues...,
+		)
+	}
+
+	for key, totalInstances := range flavors {
+		labelValues := e.labelValues([]string{key.projectID, key.flavor}, key.availabilityZone, key.cell)
+
+		ch <- prometheus.MustNewConstMetric(
+			e.instances,
+			prometheus.GaugeValue,
+			totalInstances,
+			labelValues...,
+		)
+	}
+
+	for key, stateUsage := range states {
+		labelValues := e.labelValues([]string{key.projectID, key.vmState}, key.availabilityZone, key.cell)
+
+		ch <- prometheus.MustNewConstMetric(
+			e.instancesByState,
+			prometheus.GaugeValue,
+			stateUsage.instances,
+			labelValues...,
 		)
+
+		ch <- prometheus.MustNewConstMetric(
+			e.vcpusByState,
+			prometheus.GaugeValue,
+			stateUsage.vcpus,
+			labelValues...,
+		)
+
+		ch <- prometheus.MustNewConstMetric(
+			e.ramMBByState,
+			prometheus.GaugeValue,
+			stateUsage.ramMB,
+			labelValues...,
+		)
+
+		ch <- prometheus.MustNewConstMetric(
+			e.localStorageByState,
+			prometheus.GaugeValue,
+			stateUsage.localStorageGB,
+			labelValues...,
+		)
+	}
+
+	return errors.Join(errs...)
+}
+
+// cellError names the cell in err, if any.
+func cellError(cell string, err error) error {
+	if err == nil || cell == "" {
+		return err
+	}
+	return fmt.Errorf("cell %s: %w", cell, err)
+}
+
+// labelValues appends the optional availability zone and cell labels.
+func (e *NovaUsageExporter) labelValues(labelValues []string, availabilityZone, cell string) []string {
+	if e.availabilityZoneLabel {
+		labelValues = append(labelValues, availabilityZone)
+	}
+	if e.cellLabel {
+		labelValues = append(labelValues, cell)
+	}
+	return labelValues
+}
+
+func (e *NovaUsageExporter) collectCellUsage(db *sql.DB, cell string, usage map[novaProjectKey]*novaUsage) error {
+	rows, err := db.Query("SELECT project_id, " + availabilityZoneColumn(e.availabilityZoneLabel, "availability_zone") + " AS availability_zone, SUM(vcpus) AS total_vcpus, SUM(memory_mb) AS total_ram_mb, SUM(root_gb) as total_root_gb FROM instances WHERE deleted = 0 GROUP BY 1, 2")
+	if err != nil {
+		log.Println("Error querying Nova database:", err)
+		return &queryError{query: "instances", err: err}
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var projectID string
+		var availabilityZone string
+		var totalVcpus float64
+		var totalRamMB float64
+		var totalLocalStorageGB float64
+		if err := rows.Scan(&projectID, &availabilityZone, &totalVcpus, &totalRamMB, &totalLocalStorageGB); err != nil {
+			log.Println("Error scanning Nova row:", err)
+			continue
+		}
+
+		key := novaProjectKey{projectID: projectID, availabilityZone: availabilityZone, cell: cell}
+		if usage[key] == nil {
+			usage[key] = &novaUsage{}
+		}
+		usage[key].vcpus += totalVcpus
+		usage[key].ramMB += totalRamMB
+		usage[key].localStorageGB += totalLocalStorageGB
 	}
 	if err := rows.Err(); err != nil {
 		log.Println("Error in Nova result set:", err)
+		return &queryError{query: "instances", err: err}
 	}
+
+	return nil
+}
+
+func (e *NovaUsageExporter) collectCellFlavors(db *sql.DB, cell string, flavors map[novaFlavorKey]float64) error {
+	// The flavor an instance was booted with is stored alongside the instance in
+	// instance_extra, so no lookup in the nova_api database is required and
+	// flavors deleted in the meantime are still reported with their name. Only
+	// running instances are counted, the others are covered by the vm_state
+	// metrics. The columns are grouped by position, as the flavor alias would
+	// refer to the flavor column of instance_extra.
+	rows, err := db.Query(`
+		SELECT i.project_id, COALESCE(JSON_UNQUOTE(JSON_EXTRACT(ie.flavor, '$.cur."nova_object.data".name')), 'unknown') AS flavor, ` + availabilityZoneColumn(e.availabilityZoneLabel, "i.availability_zone") + ` AS availability_zone, COUNT(i.id) AS total_instances
+		FROM instances i
+		LEFT JOIN instance_extra ie ON ie.instance_uuid = i.uuid
+		WHERE i.deleted = 0 AND i.vm_state = 'active'
+		GROUP BY 1, 2, 3
+	`)
+	if err != nil {
+		log.Println("Error querying Nova flavors:", err)
+		return &queryError{query: "flavors", err: err}
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var projectID string
+		var flavor string
+		var availabilityZone string
+		var totalInstances float64
+		if err := rows.Scan(&projectID, &flavor, &availabilityZone, &totalInstances); err != nil {
+			log.Println("Error scanning Nova flavor row:", err)
+			continue
+		}
+
+		flavors[novaFlavorKey{projectID: projectID, flavor: flavor, availabilityZone: availabilityZone, cell: cell}] += totalInstances
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error in Nova flavor result set:", err)
+		return &queryError{query: "flavors", err: err}
+	}
+
+	return nil
+}
+
+func (e *NovaUsageExporter) collectCellStates(db *sql.DB, cell string, states map[novaStateKey]*novaUsage) error {
+	// vm_state is reported as stored by Nova, e.g. active, stopped or
+	// shelved_offloaded, which allows billing instances differently that are
+	// not running or no longer occupy a hypervisor.
+	rows, err := db.Query(`
+		SELECT project_id, COALESCE(vm_state, 'unknown') AS vm_state, ` + availabilityZoneColumn(e.availabilityZoneLabel, "availability_zone") + ` AS availability_zone, COUNT(id) AS total_instances, SUM(vcpus) AS total_vcpus, SUM(memory_mb) AS total_ram_mb, SUM(root_gb) AS total_root_gb
+		FROM instances
+		WHERE deleted = 0
+		GROUP BY 1, 2, 3
+	`)
+	if err != nil {
+		log.Println("Error querying Nova vm states:", err)
+		return &queryError{query: "vm_states", err: err}
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var projectID string
+		var vmState string
+		var availabilityZone string
+		var stateUsage novaUsage
+		if err := rows.Scan(&projectID, &vmState, &availabilityZone, &stateUsage.instances, &stateUsage.vcpus, &stateUsage.ramMB, &stateUsage.localStorageGB); err != nil {
+			log.Println("Error scanning Nova vm state row:", err)
+			continue
+		}
+
+		key := novaStateKey{projectID: projectID, vmState: vmState, availabilityZone: availabilityZone, cell: cell}
+		if states[key] == nil {
+			states[key] = &novaUsage{}
+		}
+		states[key].instances += stateUsage.instances
+		states[key].vcpus += stateUsage.vcpus
+		states[key].ramMB += stateUsage.ramMB
+		states[key].localStorageGB += stateUsage.localStorageGB
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error in Nova vm state result set:", err)
+		return &queryError{query: "vm_states", err: err}
+	}
+
+	return nil
 }
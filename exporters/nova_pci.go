@@ -0,0 +1,161 @@
+package exporters
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// NovaPCIUsageExporter exposes the PCI devices passed through to the instances
+// of each project, e.g. GPUs and SR-IOV functions. VGPUs are not PCI devices
+// of the instance but are allocated in placement, so they are only reported
+// if the placement database is given. PCI devices are summed up across all
+// cells.
+type NovaPCIUsageExporter struct {
+	cells       NovaCells
+	placementDB *sql.DB
+	pciDevices  *prometheus.Desc
+	vgpus       *prometheus.Desc
+}
+
+type novaPCIDeviceKey struct {
+	projectID string
+	vendorID  string
+	productID string
+	devType   string
+}
+
+func NewNovaPCIUsageExporter(cells NovaCells, placementDB *sql.DB) (*NovaPCIUsageExporter, error) {
+	return &NovaPCIUsageExporter{
+		cells:       cells,
+		placementDB: placementDB,
+		pciDevices: prometheus.NewDesc(
+			"openstack_project_pci_devices",
+			"Total number of PCI devices assigned per OpenStack project, vendor, product and device type",
+			[]string{"project_id", "vendor_id", "product_id", "dev_type"}, nil,
+		),
+		vgpus: prometheus.NewDesc(
+			"openstack_project_vgpus",
+			"Total number of VGPUs allocated per OpenStack project",
+			[]string{"project_id"}, nil,
+		),
+	}, nil
+}
+
+func (e *NovaPCIUsageExporter) Describe(ch chan<- *prometheus.Desc) {
+	ch <- e.pciDevices
+	if e.placementDB != nil {
+		ch <- e.vgpus
+	}
+}
+
+func (e *NovaPCIUsageExporter) Collect(ch chan<- prometheus.Metric) {
+	e.collectMetrics(ch)
+}
+
+func (e *NovaPCIUsageExporter) collectMetrics(ch chan<- prometheus.Metric) error {
+	// A failing cell does not keep the other cells from being exported, its
+	// errors are reported together.
+	var errs []error
+	cells, err := e.cells.Cells()
+	if err != nil {
+		log.Println("Error discovering Nova cells:", err)
+		errs = append(errs, &queryError{query: "cell_mappings", err: err})
+	}
+
+	devices := make(map[novaPCIDeviceKey]float64)
+	for _, cell := range cells {
+		errs = append(errs, cellError(cell.Name, e.collectCellPCIDevices(cell.DB, devices)))
+	}
+
+	for key, totalDevices := range devices {
+		ch <- prometheus.MustNewConstMetric(
+			e.pciDevices,
+			prometheus.GaugeValue,
+			totalDevices,
+			key.projectID, key.vendorID, key.productID, key.devType,
+		)
+	}
+
+	if e.placementDB != nil {
+		errs = append(errs, e.collectVGPUs(ch))
+	}
+
+	return errors.Join(errs...)
+}
+
+func (e *NovaPCIUsageExporter) collectVGPUs(ch chan<- prometheus.Metric) error {
+	rows, err := e.placementDB.Query(`
+		SELECT p.external_id AS project_id, SUM(a.used) AS total_vgpus
+		FROM allocations a
+		INNER JOIN resource_classes rc ON a.resource_class_id = rc.id
+		INNER JOIN consumers c ON a.consumer_id = c.uuid
+		INNER JOIN projects p ON c.project_id = p.id
+		WHERE rc.name = 'VGPU'
+		GROUP BY p.external_id
+	`)
+	if err != nil {
+		log.Println("Error querying Placement VGPU allocations:", err)
+		return &queryError{query: "vgpus", err: err}
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var projectID string
+		var totalVGPUs float64
+		if err := rows.Scan(&projectID, &totalVGPUs); err != nil {
+			log.Println("Error scanning Placement VGPU row:", err)
+			continue
+		}
+
+		ch <- prometheus.MustNewConstMetric(
+			e.vgpus,
+			prometheus.GaugeValue,
+			totalVGPUs,
+			projectID,
+		)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Println("Error in Placement VGPU result set:", err)
+		return &queryError{query: "vgpus", err: err}
+	}
+
+	return nil
+}
+
+func (e *NovaPCIUsageExporter) collectCellPCIDevices(db *sql.DB, devices map[novaPCIDeviceKey]float64) error {
+	// Devices are claimed while an instance is being scheduled and allocated
+	// once it has been spawned with them.
+	rows, err := db.Query(`
+		SELECT i.project_id, pd.vendor_id, pd.product_id, pd.dev_type, COUNT(pd.id) AS total_devices
+		FROM pci_devices pd
+		INNER JOIN instances i ON pd.instance_uuid = i.uuid
+		WHERE pd.deleted = 0 AND pd.status = 'allocated' AND i.deleted = 0
+		GROUP BY i.project_id, pd.vendor_id, pd.product_id, pd.dev_type
+	`)
+	if err != nil {
+		log.Println("Error querying Nova PCI devices:", err)
+		return &queryError{query: "pci_devices", err: err}
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key novaPCIDeviceKey
+		var totalDevices float64
+		if err := rows.Scan(&key.projectID, &key.vendorID, &key.productID, &key.devType, &totalDevices); err != nil {
+			log.Println("Error scanning Nova PCI device row:", err)
+			continue
+		}
+		devices[key] += totalDevices
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Println("Error in Nova PCI device result set:", err)
+		return &queryError{query: "pci_devices", err: err}
+	}
+
+	return nil
+}
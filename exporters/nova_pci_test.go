@@ -0,0 +1,74 @@
+package exporters
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestNovaPCIUsageExporter(t *testing.T) {
+	cell1DB, cell1Mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create sqlmock: %v", err)
+	}
+	defer cell1DB.Close()
+
+	cell2DB, cell2Mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create sqlmock: %v", err)
+	}
+	defer cell2DB.Close()
+
+	placementDB, placementMock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create sqlmock: %v", err)
+	}
+	defer placementDB.Close()
+
+	cell1Rows := sqlmock.NewRows([]string{"project_id", "vendor_id", "product_id", "dev_type", "total_devices"}).
+		AddRow("c352b0ed-30ca-4634-9c2d-1947efc29096", "10de", "20b5", "type-PCI", 2).
+		AddRow("6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096", "8086", "154c", "type-VF", 4)
+	cell1Mock.ExpectQuery("FROM pci_devices pd INNER JOIN instances i ON pd.instance_uuid = i.uuid WHERE pd.deleted = 0 AND pd.status = 'allocated'").WillReturnRows(cell1Rows)
+
+	cell2Rows := sqlmock.NewRows([]string{"project_id", "vendor_id", "product_id", "dev_type", "total_devices"}).
+		AddRow("c352b0ed-30ca-4634-9c2d-1947efc29096", "10de", "20b5", "type-PCI", 1)
+	cell2Mock.ExpectQuery("FROM pci_devices pd INNER JOIN instances i ON pd.instance_uuid = i.uuid WHERE pd.deleted = 0 AND pd.status = 'allocated'").WillReturnRows(cell2Rows)
+
+	vgpuRows := sqlmock.NewRows([]string{"project_id", "total_vgpus"}).
+		AddRow("6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096", 1)
+	placementMock.ExpectQuery("WHERE rc.name = 'VGPU'").WillReturnRows(vgpuRows)
+
+	exporter, err := NewNovaPCIUsageExporter(StaticNovaCells{
+		{Name: "cell1", DB: cell1DB},
+		{Name: "cell2", DB: cell2DB},
+	}, placementDB)
+	if err != nil {
+		t.Fatalf("Failed to create NovaPCIUsageExporter: %v", err)
+	}
+
+	expectedMetrics := `
+        # HELP openstack_project_pci_devices Total number of PCI devices assigned per OpenStack project, vendor, product and device type
+        # TYPE openstack_project_pci_devices gauge
+        openstack_project_pci_devices{dev_type="type-PCI",product_id="20b5",project_id="c352b0ed-30ca-4634-9c2d-1947efc29096",vendor_id="10de"} 3
+        openstack_project_pci_devices{dev_type="type-VF",product_id="154c",project_id="6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096",vendor_id="8086"} 4
+        # HELP openstack_project_vgpus Total number of VGPUs allocated per OpenStack project
+        # TYPE openstack_project_vgpus gauge
+        openstack_project_vgpus{project_id="6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096"} 1
+	`
+
+	if err := testutil.CollectAndCompare(exporter, strings.NewReader(expectedMetrics)); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+
+	if err := cell1Mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+	if err := cell2Mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+	if err := placementMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
@@ -8,26 +8,32 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 )
 
+const imageTraitPrefix = "image_trait:"
+
+// NovaTraitUsageExporter counts instances requiring a trait, either through
+// their image (source "image") or their flavor's extra specs (source "flavor").
+// Traits required by host aggregate metadata are not counted, as the
+// aggregates are stored in nova_api rather than alongside the instances.
 type NovaTraitUsageExporter struct {
 	db        *sql.DB
-	trait     string
+	traits    []string
 	vcpus     *prometheus.Desc
 	instances *prometheus.Desc
 }
 
-func NewNovaTraitUsageExporter(db *sql.DB, trait string) (*NovaTraitUsageExporter, error) {
+func NewNovaTraitUsageExporter(db *sql.DB, traits []string) (*NovaTraitUsageExporter, error) {
 	return &NovaTraitUsageExporter{
-		db:    db,
-		trait: trait,
+		db:     db,
+		traits: traits,
 		vcpus: prometheus.NewDesc(
-			"openstack_project_vcpus_trait__"+strings.ToLower(trait),
-			"Total number of vcpus per OpenStack project for instances with image trait "+trait,
-			[]string{"project_id"}, nil,
+			"openstack_project_vcpus_by_trait",
+			"Total number of vcpus per OpenStack project for instances with required trait",
+			[]string{"project_id", "trait", "source"}, nil,
 		),
 		instances: prometheus.NewDesc(
-			"openstack_project_instances_trait__"+strings.ToLower(trait),
-			"Total number of instances per OpenStack project with image trait "+trait,
-			[]string{"project_id"}, nil,
+			"openstack_project_instances_by_trait",
+			"Total number of instances per OpenStack project with required trait",
+			[]string{"project_id", "trait", "source"}, nil,
 		),
 	}, nil
 }
@@ -41,38 +47,112 @@ func (e *NovaTraitUsageExporter) Collect(ch chan<- prometheus.Metric) {
 	e.collectMetrics(ch)
 }
 
-func (e *NovaTraitUsageExporter) collectMetrics(ch chan<- prometheus.Metric) {
-	rows, err := e.db.Query("SELECT i.project_id AS project_id, COUNT(i.id) AS total_instances, SUM(vcpus) AS total_vcpus FROM instances i INNER JOIN instance_system_metadata m on i.uuid = m.instance_uuid WHERE i.deleted = 0 AND m.key = ? and m.value = 'required' GROUP BY project_id", "image_trait:"+e.trait)
+func (e *NovaTraitUsageExporter) collectMetrics(ch chan<- prometheus.Metric) error {
+	if err := e.collectImageTraits(ch); err != nil {
+		return err
+	}
+
+	for _, trait := range e.traits {
+		if err := e.collectFlavorTrait(ch, trait); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (e *NovaTraitUsageExporter) collectImageTraits(ch chan<- prometheus.Metric) error {
+	keys := make([]any, len(e.traits))
+	for i, trait := range e.traits {
+		keys[i] = imageTraitPrefix + trait
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(keys)), ", ")
+
+	rows, err := e.db.Query("SELECT i.project_id AS project_id, m.key AS trait_key, COUNT(i.id) AS total_instances, SUM(vcpus) AS total_vcpus FROM instances i INNER JOIN instance_system_metadata m on i.uuid = m.instance_uuid WHERE i.deleted = 0 AND m.key IN ("+placeholders+") and m.value = 'required' GROUP BY project_id, m.key", keys...)
 	if err != nil {
 		log.Println("Error querying Nova database:", err)
-		return
+		return &queryError{query: "trait_instances", err: err}
 	}
 	defer rows.Close()
 
 	for rows.Next() {
 		var projectID string
+		var traitKey string
 		var totalVcpus float64
 		var totalInstances float64
-		if err := rows.Scan(&projectID, &totalInstances, &totalVcpus); err != nil {
+		if err := rows.Scan(&projectID, &traitKey, &totalInstances, &totalVcpus); err != nil {
 			log.Println("Error scanning Nova row:", err)
 			continue
 		}
+		trait := strings.TrimPrefix(traitKey, imageTraitPrefix)
 
 		ch <- prometheus.MustNewConstMetric(
 			e.vcpus,
 			prometheus.GaugeValue,
 			totalVcpus,
-			projectID,
+			projectID, trait, "image",
 		)
 
 		ch <- prometheus.MustNewConstMetric(
 			e.instances,
 			prometheus.GaugeValue,
 			totalInstances,
-			projectID,
+			projectID, trait, "image",
 		)
 	}
 	if err := rows.Err(); err != nil {
 		log.Println("Error in Nova result set:", err)
+		return &queryError{query: "trait_instances", err: err}
+	}
+
+	return nil
+}
+
+func (e *NovaTraitUsageExporter) collectFlavorTrait(ch chan<- prometheus.Metric, trait string) error {
+	// The flavor including its extra specs is stored with every instance, so
+	// later changes to the flavor do not affect existing instances.
+	extraSpecPath := `$.cur."nova_object.data".extra_specs."trait:` + trait + `"`
+
+	rows, err := e.db.Query(`
+		SELECT i.project_id, COUNT(i.id) AS total_instances, SUM(i.vcpus) AS total_vcpus
+		FROM instances i
+		INNER JOIN instance_extra ie ON ie.instance_uuid = i.uuid
+		WHERE i.deleted = 0 AND JSON_UNQUOTE(JSON_EXTRACT(ie.flavor, ?)) = 'required'
+		GROUP BY i.project_id
+	`, extraSpecPath)
+	if err != nil {
+		log.Println("Error querying Nova flavor traits:", err)
+		return &queryError{query: "flavor_trait_instances", err: err}
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var projectID string
+		var totalInstances float64
+		var totalVcpus float64
+		if err := rows.Scan(&projectID, &totalInstances, &totalVcpus); err != nil {
+			log.Println("Error scanning Nova flavor trait row:", err)
+			continue
+		}
+
+		ch <- prometheus.MustNewConstMetric(
+			e.vcpus,
+			prometheus.GaugeValue,
+			totalVcpus,
+			projectID, trait, "flavor",
+		)
+
+		ch <- prometheus.MustNewConstMetric(
+			e.instances,
+			prometheus.GaugeValue,
+			totalInstances,
+			projectID, trait, "flavor",
+		)
 	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error in Nova flavor trait result set:", err)
+		return &queryError{query: "flavor_trait_instances", err: err}
+	}
+
+	return nil
 }
@@ -15,25 +15,37 @@ func TestNovaTraitUsageExporter(t *testing.T) {
 	}
 	defer db.Close()
 
-	rows := sqlmock.NewRows([]string{"project_id", "total_instances", "total_vcpus"}).
-		AddRow("c352b0ed-30ca-4634-9c2d-1947efc29096", 0, 0).
-		AddRow("6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096", 4, 5)
-	mock.ExpectQuery("SELECT").WillReturnRows(rows)
+	rows := sqlmock.NewRows([]string{"project_id", "trait_key", "total_instances", "total_vcpus"}).
+		AddRow("c352b0ed-30ca-4634-9c2d-1947efc29096", "image_trait:CUSTOM_TRAIT", 0, 0).
+		AddRow("6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096", "image_trait:CUSTOM_TRAIT", 4, 5).
+		AddRow("6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096", "image_trait:CUSTOM_OTHER_TRAIT", 1, 2)
+	mock.ExpectQuery("SELECT").WithArgs("image_trait:CUSTOM_TRAIT", "image_trait:CUSTOM_OTHER_TRAIT").WillReturnRows(rows)
 
-	exporter, err := NewNovaTraitUsageExporter(db, "CUSTOM_TRAIT")
+	flavorRows := sqlmock.NewRows([]string{"project_id", "total_instances", "total_vcpus"}).
+		AddRow("c352b0ed-30ca-4634-9c2d-1947efc29096", 2, 16)
+	mock.ExpectQuery("SELECT i.project_id, COUNT").WithArgs(`$.cur."nova_object.data".extra_specs."trait:CUSTOM_TRAIT"`).WillReturnRows(flavorRows)
+
+	mock.ExpectQuery("SELECT i.project_id, COUNT").WithArgs(`$.cur."nova_object.data".extra_specs."trait:CUSTOM_OTHER_TRAIT"`).
+		WillReturnRows(sqlmock.NewRows([]string{"project_id", "total_instances", "total_vcpus"}))
+
+	exporter, err := NewNovaTraitUsageExporter(db, []string{"CUSTOM_TRAIT", "CUSTOM_OTHER_TRAIT"})
 	if err != nil {
 		t.Fatalf("Failed to create NewNovaTraitUsageExporter: %v", err)
 	}
 
 	expectedMetrics := `
-        # HELP openstack_project_instances_trait__custom_trait Total number of instances per OpenStack project with image trait CUSTOM_TRAIT
-        # TYPE openstack_project_instances_trait__custom_trait gauge
-        openstack_project_instances_trait__custom_trait{project_id="6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096"} 4
-        openstack_project_instances_trait__custom_trait{project_id="c352b0ed-30ca-4634-9c2d-1947efc29096"} 0
-        # HELP openstack_project_vcpus_trait__custom_trait Total number of vcpus per OpenStack project for instances with image trait CUSTOM_TRAIT
-        # TYPE openstack_project_vcpus_trait__custom_trait gauge
-        openstack_project_vcpus_trait__custom_trait{project_id="6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096"} 5
-        openstack_project_vcpus_trait__custom_trait{project_id="c352b0ed-30ca-4634-9c2d-1947efc29096"} 0
+        # HELP openstack_project_instances_by_trait Total number of instances per OpenStack project with required trait
+        # TYPE openstack_project_instances_by_trait gauge
+        openstack_project_instances_by_trait{project_id="6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096",source="image",trait="CUSTOM_OTHER_TRAIT"} 1
+        openstack_project_instances_by_trait{project_id="6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096",source="image",trait="CUSTOM_TRAIT"} 4
+        openstack_project_instances_by_trait{project_id="c352b0ed-30ca-4634-9c2d-1947efc29096",source="flavor",trait="CUSTOM_TRAIT"} 2
+        openstack_project_instances_by_trait{project_id="c352b0ed-30ca-4634-9c2d-1947efc29096",source="image",trait="CUSTOM_TRAIT"} 0
+        # HELP openstack_project_vcpus_by_trait Total number of vcpus per OpenStack project for instances with required trait
+        # TYPE openstack_project_vcpus_by_trait gauge
+        openstack_project_vcpus_by_trait{project_id="6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096",source="image",trait="CUSTOM_OTHER_TRAIT"} 2
+        openstack_project_vcpus_by_trait{project_id="6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096",source="image",trait="CUSTOM_TRAIT"} 5
+        openstack_project_vcpus_by_trait{project_id="c352b0ed-30ca-4634-9c2d-1947efc29096",source="flavor",trait="CUSTOM_TRAIT"} 16
+        openstack_project_vcpus_by_trait{project_id="c352b0ed-30ca-4634-9c2d-1947efc29096",source="image",trait="CUSTOM_TRAIT"} 0
 
 	`
 
@@ -8,8 +8,11 @@ import (
 )
 
 type OctaviaUsageExporter struct {
-	db          *sql.DB
+	db            *sql.DB
 	loadBalancers *prometheus.Desc
+	listeners     *prometheus.Desc
+	pools         *prometheus.Desc
+	members       *prometheus.Desc
 }
 
 func NewOctaviaUsageExporter(db *sql.DB) (*OctaviaUsageExporter, error) {
@@ -17,7 +20,22 @@ func NewOctaviaUsageExporter(db *sql.DB) (*OctaviaUsageExporter, error) {
 		db: db,
 		loadBalancers: prometheus.NewDesc(
 			"openstack_project_load_balancers",
-			"Total number of load balancers per OpenStack project",
+			"Total number of load balancers per OpenStack project, provider, flavor and topology",
+			[]string{"project_id", "provider", "flavor", "topology"}, nil,
+		),
+		listeners: prometheus.NewDesc(
+			"openstack_project_load_balancer_listeners",
+			"Total number of load balancer listeners per OpenStack project",
+			[]string{"project_id"}, nil,
+		),
+		pools: prometheus.NewDesc(
+			"openstack_project_load_balancer_pools",
+			"Total number of load balancer pools per OpenStack project",
+			[]string{"project_id"}, nil,
+		),
+		members: prometheus.NewDesc(
+			"openstack_project_load_balancer_members",
+			"Total number of load balancer pool members per OpenStack project",
 			[]string{"project_id"}, nil,
 		),
 	}, nil
@@ -25,43 +43,118 @@ func NewOctaviaUsageExporter(db *sql.DB) (*OctaviaUsageExporter, error) {
 
 func (e *OctaviaUsageExporter) Describe(ch chan<- *prometheus.Desc) {
 	ch <- e.loadBalancers
+	ch <- e.listeners
+	ch <- e.pools
+	ch <- e.members
 }
 
 func (e *OctaviaUsageExporter) Collect(ch chan<- prometheus.Metric) {
 	e.collectMetrics(ch)
 }
 
-func (e *OctaviaUsageExporter) collectMetrics(ch chan<- prometheus.Metric) {
+func (e *OctaviaUsageExporter) collectMetrics(ch chan<- prometheus.Metric) error {
+	// Load balancers without a flavor use the provider defaults and are
+	// reported with an empty flavor. The topology is only known to the amphora
+	// provider. The columns are grouped by position, as the provider and
+	// topology aliases would refer to the raw columns, and the rows are summed
+	// up, as NULL and empty values end up in the same series.
 	rows, err := e.db.Query(`
-		SELECT project_id, COUNT(id) as total_lbs 
-		FROM load_balancer 
-		WHERE provisioning_status != "DELETED" 
-		GROUP BY project_id
+		SELECT lb.project_id, COALESCE(lb.provider, '') AS provider, COALESCE(f.name, '') AS flavor, COALESCE(lb.topology, '') AS topology, COUNT(lb.id) as total_lbs
+		FROM load_balancer lb
+		LEFT JOIN flavor f ON lb.flavor_id = f.id
+		WHERE lb.provisioning_status != "DELETED"
+		GROUP BY 1, 2, 3, 4
 	`)
 
 	if err != nil {
 		log.Println("Error querying Octavia database:", err)
-		return
+		return &queryError{query: "load_balancers", err: err}
 	}
 	defer rows.Close()
 
+	type loadBalancerKey struct {
+		projectID string
+		provider  string
+		flavor    string
+		topology  string
+	}
+
+	loadBalancers := make(map[loadBalancerKey]float64)
+
 	for rows.Next() {
-		var projectID string
+		var projectID, provider, flavor, topology string
 		var totalLoadBalancers float64
-		if err := rows.Scan(&projectID, &totalLoadBalancers); err != nil {
+		if err := rows.Scan(&projectID, &provider, &flavor, &topology, &totalLoadBalancers); err != nil {
 			log.Println("Error scanning Octavia row:", err)
 			continue
 		}
 
+		loadBalancers[loadBalancerKey{projectID, provider, flavor, topology}] += totalLoadBalancers
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Println("Error in Octavia result set:", err)
+		return &queryError{query: "load_balancers", err: err}
+	}
+
+	for key, totalLoadBalancers := range loadBalancers {
 		ch <- prometheus.MustNewConstMetric(
 			e.loadBalancers,
 			prometheus.GaugeValue,
 			totalLoadBalancers,
+			key.projectID, key.provider, key.flavor, key.topology,
+		)
+	}
+
+	if err := e.collectProjectCounts(ch, "listener", e.listeners); err != nil {
+		return err
+	}
+	if err := e.collectProjectCounts(ch, "pool", e.pools); err != nil {
+		return err
+	}
+	if err := e.collectProjectCounts(ch, "member", e.members); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// collectProjectCounts emits the number of rows in table per project, which
+// is also used as the query name.
+func (e *OctaviaUsageExporter) collectProjectCounts(ch chan<- prometheus.Metric, table string, desc *prometheus.Desc) error {
+	rows, err := e.db.Query(`
+		SELECT project_id, COUNT(id) AS total
+		FROM ` + table + `
+		WHERE provisioning_status != "DELETED"
+		GROUP BY project_id
+	`)
+
+	if err != nil {
+		log.Printf("Error querying Octavia %s counts: %s", table, err)
+		return &queryError{query: table + "s", err: err}
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var projectID string
+		var total float64
+		if err := rows.Scan(&projectID, &total); err != nil {
+			log.Printf("Error scanning Octavia %s row: %s", table, err)
+			continue
+		}
+
+		ch <- prometheus.MustNewConstMetric(
+			desc,
+			prometheus.GaugeValue,
+			total,
 			projectID,
 		)
 	}
 
 	if err := rows.Err(); err != nil {
-		log.Println("Error in Octavia result set:", err)
+		log.Printf("Error in Octavia %s result set: %s", table, err)
+		return &queryError{query: table + "s", err: err}
 	}
+
+	return nil
 }
@@ -15,11 +15,25 @@ func TestOctaviaUsageExporter(t *testing.T) {
 	}
 	defer db.Close()
 
-	rows := sqlmock.NewRows([]string{"project_id", "total_lbs"}).
-		AddRow("c352b0ed-30ca-4634-9c2d-1947efc29096", 5).
-		AddRow("6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096", 3)
+	rows := sqlmock.NewRows([]string{"project_id", "provider", "flavor", "topology", "total_lbs"}).
+		AddRow("c352b0ed-30ca-4634-9c2d-1947efc29096", "amphora", "ha", "ACTIVE_STANDBY", 4).
+		AddRow("c352b0ed-30ca-4634-9c2d-1947efc29096", "amphora", "", "SINGLE", 1).
+		AddRow("6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096", "ovn", "", "", 3).
+		// A NULL topology ends up in the same series as an empty one.
+		AddRow("6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096", "ovn", "", "", 2)
 
-	mock.ExpectQuery("SELECT project_id, COUNT").WillReturnRows(rows)
+	mock.ExpectQuery("SELECT lb.project_id, .* FROM load_balancer lb LEFT JOIN flavor f ON lb.flavor_id = f.id .* GROUP BY 1, 2, 3, 4").WillReturnRows(rows)
+
+	mock.ExpectQuery("SELECT project_id, COUNT\\(id\\) AS total FROM listener").WillReturnRows(
+		sqlmock.NewRows([]string{"project_id", "total"}).
+			AddRow("c352b0ed-30ca-4634-9c2d-1947efc29096", 6).
+			AddRow("6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096", 3))
+	mock.ExpectQuery("SELECT project_id, COUNT\\(id\\) AS total FROM pool").WillReturnRows(
+		sqlmock.NewRows([]string{"project_id", "total"}).
+			AddRow("c352b0ed-30ca-4634-9c2d-1947efc29096", 6))
+	mock.ExpectQuery("SELECT project_id, COUNT\\(id\\) AS total FROM member").WillReturnRows(
+		sqlmock.NewRows([]string{"project_id", "total"}).
+			AddRow("c352b0ed-30ca-4634-9c2d-1947efc29096", 12))
 
 	exporter, err := NewOctaviaUsageExporter(db)
 	if err != nil {
@@ -27,10 +41,21 @@ func TestOctaviaUsageExporter(t *testing.T) {
 	}
 
 	expectedMetrics := `
-        # HELP openstack_project_load_balancers Total number of load balancers per OpenStack project
+        # HELP openstack_project_load_balancer_listeners Total number of load balancer listeners per OpenStack project
+        # TYPE openstack_project_load_balancer_listeners gauge
+        openstack_project_load_balancer_listeners{project_id="6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096"} 3
+        openstack_project_load_balancer_listeners{project_id="c352b0ed-30ca-4634-9c2d-1947efc29096"} 6
+        # HELP openstack_project_load_balancer_members Total number of load balancer pool members per OpenStack project
+        # TYPE openstack_project_load_balancer_members gauge
+        openstack_project_load_balancer_members{project_id="c352b0ed-30ca-4634-9c2d-1947efc29096"} 12
+        # HELP openstack_project_load_balancer_pools Total number of load balancer pools per OpenStack project
+        # TYPE openstack_project_load_balancer_pools gauge
+        openstack_project_load_balancer_pools{project_id="c352b0ed-30ca-4634-9c2d-1947efc29096"} 6
+        # HELP openstack_project_load_balancers Total number of load balancers per OpenStack project, provider, flavor and topology
         # TYPE openstack_project_load_balancers gauge
-        openstack_project_load_balancers{project_id="6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096"} 3
-        openstack_project_load_balancers{project_id="c352b0ed-30ca-4634-9c2d-1947efc29096"} 5
+        openstack_project_load_balancers{flavor="",project_id="6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096",provider="ovn",topology=""} 5
+        openstack_project_load_balancers{flavor="",project_id="c352b0ed-30ca-4634-9c2d-1947efc29096",provider="amphora",topology="SINGLE"} 1
+        openstack_project_load_balancers{flavor="ha",project_id="c352b0ed-30ca-4634-9c2d-1947efc29096",provider="amphora",topology="ACTIVE_STANDBY"} 4
 	`
 
 	if err := testutil.CollectAndCompare(exporter, strings.NewReader(expectedMetrics)); err != nil {
@@ -0,0 +1,310 @@
+package exporters
+
+import (
+	"database/sql"
+	"log"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// PlacementCapacityExporter exposes the inventories of all resource providers
+// in the placement database, i.e. the supply the usage metrics can be compared
+// with. Compute node providers are named after their hypervisor hostname.
+// Aggregates are only known to placement by their uuid, their names are read
+// from the nova_api database.
+type PlacementCapacityExporter struct {
+	db              *sql.DB
+	apiDB           *sql.DB
+	total           *prometheus.Desc
+	reserved        *prometheus.Desc
+	allocationRatio *prometheus.Desc
+	used            *prometheus.Desc
+	aggregate       *prometheus.Desc
+}
+
+type resourceProviderKey struct {
+	hostname      string
+	resourceClass string
+}
+
+// NewPlacementCapacityExporter creates a Placement capacity exporter. Without
+// apiDB, or if it is unreachable, the aggregate names are left empty.
+func NewPlacementCapacityExporter(db *sql.DB, apiDB *sql.DB) (*PlacementCapacityExporter, error) {
+	return &PlacementCapacityExporter{
+		db:    db,
+		apiDB: apiDB,
+		total: prometheus.NewDesc(
+			"openstack_resource_provider_capacity_total",
+			"Total inventory per resource provider and resource class",
+			[]string{"hostname", "resource_class"}, nil,
+		),
+		reserved: prometheus.NewDesc(
+			"openstack_resource_provider_capacity_reserved",
+			"Reserved inventory per resource provider and resource class",
+			[]string{"hostname", "resource_class"}, nil,
+		),
+		allocationRatio: prometheus.NewDesc(
+			"openstack_resource_provider_allocation_ratio",
+			"Allocation ratio per resource provider and resource class",
+			[]string{"hostname", "resource_class"}, nil,
+		),
+		used: prometheus.NewDesc(
+			"openstack_resource_provider_capacity_used",
+			"Allocated amount per resource provider and resource class",
+			[]string{"hostname", "resource_class"}, nil,
+		),
+		aggregate: prometheus.NewDesc(
+			"openstack_resource_provider_aggregate_info",
+			"Aggregates a resource provider is member of",
+			[]string{"hostname", "aggregate_id", "aggregate"}, nil,
+		),
+	}, nil
+}
+
+func (e *PlacementCapacityExporter) Describe(ch chan<- *prometheus.Desc) {
+	ch <- e.total
+	ch <- e.reserved
+	ch <- e.allocationRatio
+	ch <- e.used
+	ch <- e.aggregate
+}
+
+func (e *PlacementCapacityExporter) Collect(ch chan<- prometheus.Metric) {
+	e.collectMetrics(ch)
+}
+
+func (e *PlacementCapacityExporter) collectMetrics(ch chan<- prometheus.Metric) error {
+	// Placement keeps the standard resource classes in resource_classes as well,
+	// so all classes including CUSTOM_* ones are resolved to their name.
+	rows, err := e.db.Query(`
+		SELECT rp.name, COALESCE(rc.name, 'unknown') AS resource_class, i.total, i.reserved, i.allocation_ratio
+		FROM inventories i
+		INNER JOIN resource_providers rp ON i.resource_provider_id = rp.id
+		LEFT JOIN resource_classes rc ON i.resource_class_id = rc.id
+	`)
+	if err != nil {
+		log.Println("Error querying Placement inventories:", err)
+		return &queryError{query: "inventories", err: err}
+	}
+	defer rows.Close()
+
+	type inventory struct {
+		total           float64
+		reserved        float64
+		allocationRatio float64
+	}
+	inventories := make(map[resourceProviderKey]inventory)
+
+	for rows.Next() {
+		var key resourceProviderKey
+		var inv inventory
+		if err := rows.Scan(&key.hostname, &key.resourceClass, &inv.total, &inv.reserved, &inv.allocationRatio); err != nil {
+			log.Println("Error scanning Placement inventory row:", err)
+			continue
+		}
+		inventories[key] = inv
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Println("Error in Placement inventories result set:", err)
+		return &queryError{query: "inventories", err: err}
+	}
+
+	rows, err = e.db.Query(`
+		SELECT rp.name, COALESCE(rc.name, 'unknown') AS resource_class, SUM(a.used) AS used
+		FROM allocations a
+		INNER JOIN resource_providers rp ON a.resource_provider_id = rp.id
+		LEFT JOIN resource_classes rc ON a.resource_class_id = rc.id
+		GROUP BY rp.name, resource_class
+	`)
+	if err != nil {
+		log.Println("Error querying Placement allocations:", err)
+		return &queryError{query: "allocations", err: err}
+	}
+	defer rows.Close()
+
+	used := make(map[resourceProviderKey]float64)
+	for rows.Next() {
+		var key resourceProviderKey
+		var totalUsed float64
+		if err := rows.Scan(&key.hostname, &key.resourceClass, &totalUsed); err != nil {
+			log.Println("Error scanning Placement allocation row:", err)
+			continue
+		}
+		used[key] = totalUsed
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Println("Error in Placement allocations result set:", err)
+		return &queryError{query: "allocations", err: err}
+	}
+
+	rows, err = e.db.Query(`
+		SELECT rp.name, pa.uuid
+		FROM resource_provider_aggregates rpa
+		INNER JOIN resource_providers rp ON rpa.resource_provider_id = rp.id
+		INNER JOIN placement_aggregates pa ON rpa.aggregate_id = pa.id
+	`)
+	if err != nil {
+		log.Println("Error querying Placement aggregates:", err)
+		return &queryError{query: "aggregates", err: err}
+	}
+	defer rows.Close()
+
+	var aggregates [][2]string
+	for rows.Next() {
+		var hostname, aggregateID string
+		if err := rows.Scan(&hostname, &aggregateID); err != nil {
+			log.Println("Error scanning Placement aggregate row:", err)
+			continue
+		}
+		aggregates = append(aggregates, [2]string{hostname, aggregateID})
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Println("Error in Placement aggregates result set:", err)
+		return &queryError{query: "aggregates", err: err}
+	}
+
+	aggregateNames := e.collectAggregateNames()
+
+	// Inventories without allocations are reported as unused.
+	for key, inv := range inventories {
+		ch <- prometheus.MustNewConstMetric(
+			e.total,
+			prometheus.GaugeValue,
+			inv.total,
+			key.hostname, key.resourceClass,
+		)
+
+		ch <- prometheus.MustNewConstMetric(
+			e.reserved,
+			prometheus.GaugeValue,
+			inv.reserved,
+			key.hostname, key.resourceClass,
+		)
+
+		ch <- prometheus.MustNewConstMetric(
+			e.allocationRatio,
+			prometheus.GaugeValue,
+			inv.allocationRatio,
+			key.hostname, key.resourceClass,
+		)
+
+		ch <- prometheus.MustNewConstMetric(
+			e.used,
+			prometheus.GaugeValue,
+			used[key],
+			key.hostname, key.resourceClass,
+		)
+	}
+
+	for _, aggregate := range aggregates {
+		ch <- prometheus.MustNewConstMetric(
+			e.aggregate,
+			prometheus.GaugeValue,
+			1,
+			aggregate[0], aggregate[1], aggregateNames[aggregate[1]],
+		)
+	}
+
+	return nil
+}
+
+// collectAggregateNames returns the names of the Nova aggregates by uuid. The
+// names are informational only, so without apiDB or if it cannot be queried
+// they are left empty instead of failing the collection.
+func (e *PlacementCapacityExporter) collectAggregateNames() map[string]string {
+	aggregateNames := make(map[string]string)
+	if e.apiDB == nil {
+		return aggregateNames
+	}
+
+	rows, err := e.apiDB.Query("SELECT uuid, name FROM aggregates")
+	if err != nil {
+		log.Println("Error querying Nova aggregates, leaving aggregate names empty:", err)
+		return aggregateNames
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var aggregateID, name string
+		if err := rows.Scan(&aggregateID, &name); err != nil {
+			log.Println("Error scanning Nova aggregate row:", err)
+			continue
+		}
+		aggregateNames[aggregateID] = name
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Println("Error in Nova aggregates result set:", err)
+	}
+
+	return aggregateNames
+}
+
+// PlacementUsageExporter exposes the resources claimed by the scheduler per
+// project, including PCI devices and custom resource classes that are not
+// part of the Nova instance records.
+type PlacementUsageExporter struct {
+	db    *sql.DB
+	usage *prometheus.Desc
+}
+
+func NewPlacementUsageExporter(db *sql.DB) (*PlacementUsageExporter, error) {
+	return &PlacementUsageExporter{
+		db: db,
+		usage: prometheus.NewDesc(
+			"openstack_project_placement_usage",
+			"Total allocated amount per OpenStack project and resource class",
+			[]string{"project_id", "resource_class"}, nil,
+		),
+	}, nil
+}
+
+func (e *PlacementUsageExporter) Describe(ch chan<- *prometheus.Desc) {
+	ch <- e.usage
+}
+
+func (e *PlacementUsageExporter) Collect(ch chan<- prometheus.Metric) {
+	e.collectMetrics(ch)
+}
+
+func (e *PlacementUsageExporter) collectMetrics(ch chan<- prometheus.Metric) error {
+	rows, err := e.db.Query(`
+		SELECT p.external_id AS project_id, COALESCE(rc.name, 'unknown') AS resource_class, SUM(a.used) AS used
+		FROM allocations a
+		INNER JOIN consumers c ON a.consumer_id = c.uuid
+		INNER JOIN projects p ON c.project_id = p.id
+		LEFT JOIN resource_classes rc ON a.resource_class_id = rc.id
+		GROUP BY p.external_id, resource_class
+	`)
+	if err != nil {
+		log.Println("Error querying Placement usage:", err)
+		return &queryError{query: "allocations", err: err}
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var projectID, resourceClass string
+		var used float64
+		if err := rows.Scan(&projectID, &resourceClass, &used); err != nil {
+			log.Println("Error scanning Placement usage row:", err)
+			continue
+		}
+
+		ch <- prometheus.MustNewConstMetric(
+			e.usage,
+			prometheus.GaugeValue,
+			used,
+			projectID, resourceClass,
+		)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Println("Error in Placement usage result set:", err)
+		return &queryError{query: "allocations", err: err}
+	}
+
+	return nil
+}
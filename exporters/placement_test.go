@@ -0,0 +1,176 @@
+package exporters
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestPlacementCapacityExporter(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	inventoryRows := sqlmock.NewRows([]string{"name", "resource_class", "total", "reserved", "allocation_ratio"}).
+		AddRow("compute1", "VCPU", 64, 4, 4.0).
+		AddRow("compute1", "MEMORY_MB", 257024, 4096, 1.0).
+		AddRow("compute2", "VCPU", 64, 4, 4.0)
+	mock.ExpectQuery("SELECT rp.name, .* FROM inventories i INNER JOIN resource_providers rp").WillReturnRows(inventoryRows)
+
+	allocationRows := sqlmock.NewRows([]string{"name", "resource_class", "used"}).
+		AddRow("compute1", "VCPU", 96).
+		AddRow("compute1", "MEMORY_MB", 131072)
+	mock.ExpectQuery("SELECT rp.name, .* SUM\\(a.used\\) AS used FROM allocations a").WillReturnRows(allocationRows)
+
+	aggregateRows := sqlmock.NewRows([]string{"name", "uuid"}).
+		AddRow("compute1", "1a1dd8f6-6c59-4d71-a3fb-3f8a1cde1c3b").
+		AddRow("compute2", "1a1dd8f6-6c59-4d71-a3fb-3f8a1cde1c3b")
+	mock.ExpectQuery("SELECT rp.name, pa.uuid FROM resource_provider_aggregates rpa").WillReturnRows(aggregateRows)
+
+	apiDB, apiMock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create sqlmock: %v", err)
+	}
+	defer apiDB.Close()
+
+	aggregateNameRows := sqlmock.NewRows([]string{"uuid", "name"}).
+		AddRow("1a1dd8f6-6c59-4d71-a3fb-3f8a1cde1c3b", "gpu-hosts")
+	apiMock.ExpectQuery("SELECT uuid, name FROM aggregates").WillReturnRows(aggregateNameRows)
+
+	exporter, err := NewPlacementCapacityExporter(db, apiDB)
+	if err != nil {
+		t.Fatalf("Failed to create PlacementCapacityExporter: %v", err)
+	}
+
+	expectedMetrics := `
+        # HELP openstack_resource_provider_aggregate_info Aggregates a resource provider is member of
+        # TYPE openstack_resource_provider_aggregate_info gauge
+        openstack_resource_provider_aggregate_info{aggregate="gpu-hosts",aggregate_id="1a1dd8f6-6c59-4d71-a3fb-3f8a1cde1c3b",hostname="compute1"} 1
+        openstack_resource_provider_aggregate_info{aggregate="gpu-hosts",aggregate_id="1a1dd8f6-6c59-4d71-a3fb-3f8a1cde1c3b",hostname="compute2"} 1
+        # HELP openstack_resource_provider_allocation_ratio Allocation ratio per resource provider and resource class
+        # TYPE openstack_resource_provider_allocation_ratio gauge
+        openstack_resource_provider_allocation_ratio{hostname="compute1",resource_class="MEMORY_MB"} 1
+        openstack_resource_provider_allocation_ratio{hostname="compute1",resource_class="VCPU"} 4
+        openstack_resource_provider_allocation_ratio{hostname="compute2",resource_class="VCPU"} 4
+        # HELP openstack_resource_provider_capacity_reserved Reserved inventory per resource provider and resource class
+        # TYPE openstack_resource_provider_capacity_reserved gauge
+        openstack_resource_provider_capacity_reserved{hostname="compute1",resource_class="MEMORY_MB"} 4096
+        openstack_resource_provider_capacity_reserved{hostname="compute1",resource_class="VCPU"} 4
+        openstack_resource_provider_capacity_reserved{hostname="compute2",resource_class="VCPU"} 4
+        # HELP openstack_resource_provider_capacity_total Total inventory per resource provider and resource class
+        # TYPE openstack_resource_provider_capacity_total gauge
+        openstack_resource_provider_capacity_total{hostname="compute1",resource_class="MEMORY_MB"} 257024
+        openstack_resource_provider_capacity_total{hostname="compute1",resource_class="VCPU"} 64
+        openstack_resource_provider_capacity_total{hostname="compute2",resource_class="VCPU"} 64
+        # HELP openstack_resource_provider_capacity_used Allocated amount per resource provider and resource class
+        # TYPE openstack_resource_provider_capacity_used gauge
+        openstack_resource_provider_capacity_used{hostname="compute1",resource_class="MEMORY_MB"} 131072
+        openstack_resource_provider_capacity_used{hostname="compute1",resource_class="VCPU"} 96
+        openstack_resource_provider_capacity_used{hostname="compute2",resource_class="VCPU"} 0
+	`
+
+	if err := testutil.CollectAndCompare(exporter, strings.NewReader(expectedMetrics)); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+	if err := apiMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestPlacementCapacityExporterAggregateNamesUnavailable(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery("FROM inventories i").WillReturnRows(
+		sqlmock.NewRows([]string{"name", "resource_class", "total", "reserved", "allocation_ratio"}))
+	mock.ExpectQuery("FROM allocations a").WillReturnRows(
+		sqlmock.NewRows([]string{"name", "resource_class", "used"}))
+	mock.ExpectQuery("FROM resource_provider_aggregates rpa").WillReturnRows(
+		sqlmock.NewRows([]string{"name", "uuid"}).
+			AddRow("compute1", "1a1dd8f6-6c59-4d71-a3fb-3f8a1cde1c3b"))
+
+	apiDB, apiMock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create sqlmock: %v", err)
+	}
+	defer apiDB.Close()
+
+	apiMock.ExpectQuery("SELECT uuid, name FROM aggregates").WillReturnError(errors.New("connection refused"))
+
+	exporter, err := NewPlacementCapacityExporter(db, apiDB)
+	if err != nil {
+		t.Fatalf("Failed to create PlacementCapacityExporter: %v", err)
+	}
+
+	collector := NewCollector("placement-capacity", exporter, 0)
+
+	expectedMetrics := `
+        # HELP openstack_resource_provider_aggregate_info Aggregates a resource provider is member of
+        # TYPE openstack_resource_provider_aggregate_info gauge
+        openstack_resource_provider_aggregate_info{aggregate="",aggregate_id="1a1dd8f6-6c59-4d71-a3fb-3f8a1cde1c3b",hostname="compute1"} 1
+	`
+
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(expectedMetrics), "openstack_resource_provider_aggregate_info"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+
+	if status := collector.Status(); !status.LastRunSucceeded {
+		t.Errorf("expected the collection to succeed without aggregate names, got %+v", status)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+	if err := apiMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestPlacementUsageExporter(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	rows := sqlmock.NewRows([]string{"project_id", "resource_class", "used"}).
+		AddRow("c352b0ed-30ca-4634-9c2d-1947efc29096", "VCPU", 8).
+		AddRow("c352b0ed-30ca-4634-9c2d-1947efc29096", "MEMORY_MB", 16384).
+		AddRow("c352b0ed-30ca-4634-9c2d-1947efc29096", "CUSTOM_BAREMETAL_GOLD", 1).
+		AddRow("6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096", "VGPU", 2)
+	mock.ExpectQuery("FROM allocations a INNER JOIN consumers c ON a.consumer_id = c.uuid INNER JOIN projects p ON c.project_id = p.id").WillReturnRows(rows)
+
+	exporter, err := NewPlacementUsageExporter(db)
+	if err != nil {
+		t.Fatalf("Failed to create PlacementUsageExporter: %v", err)
+	}
+
+	expectedMetrics := `
+        # HELP openstack_project_placement_usage Total allocated amount per OpenStack project and resource class
+        # TYPE openstack_project_placement_usage gauge
+        openstack_project_placement_usage{project_id="6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096",resource_class="VGPU"} 2
+        openstack_project_placement_usage{project_id="c352b0ed-30ca-4634-9c2d-1947efc29096",resource_class="CUSTOM_BAREMETAL_GOLD"} 1
+        openstack_project_placement_usage{project_id="c352b0ed-30ca-4634-9c2d-1947efc29096",resource_class="MEMORY_MB"} 16384
+        openstack_project_placement_usage{project_id="c352b0ed-30ca-4634-9c2d-1947efc29096",resource_class="VCPU"} 8
+	`
+
+	if err := testutil.CollectAndCompare(exporter, strings.NewReader(expectedMetrics)); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
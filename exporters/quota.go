@@ -0,0 +1,231 @@
+package exporters
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// QuotaExporter exposes the quotas of one service. Quotas are only stored for
+// projects with overrides, every other resource of such a project falls back
+// to the default quota. Defaults are read from the default quota class where
+// the service supports one, otherwise the configured defaults are used. They
+// are exposed separately as well, for projects without any override. With the
+// keystone database, the effective quota is exposed for every project.
+type QuotaExporter struct {
+	db            *sql.DB
+	keystoneDB    *sql.DB
+	quotasQuery   string
+	defaultsQuery string
+	defaults      map[string]float64
+	quota         *prometheus.Desc
+	defaultQuota  *prometheus.Desc
+}
+
+func newQuotaExporter(db, keystoneDB *sql.DB, service, quotasQuery, defaultsQuery string, defaults map[string]float64) *QuotaExporter {
+	return &QuotaExporter{
+		db:            db,
+		keystoneDB:    keystoneDB,
+		quotasQuery:   quotasQuery,
+		defaultsQuery: defaultsQuery,
+		defaults:      defaults,
+		quota: prometheus.NewDesc(
+			"openstack_project_quota_"+service,
+			"Quota per OpenStack project and "+service+" resource",
+			[]string{"project_id", "resource"}, nil,
+		),
+		defaultQuota: prometheus.NewDesc(
+			"openstack_default_quota_"+service,
+			"Default quota per "+service+" resource",
+			[]string{"resource"}, nil,
+		),
+	}
+}
+
+func NewNovaQuotaExporter(db *sql.DB, keystoneDB *sql.DB, defaults map[string]float64) (*QuotaExporter, error) {
+	return newQuotaExporter(db, keystoneDB, "nova",
+		"SELECT project_id, resource, hard_limit FROM quotas",
+		"SELECT resource, hard_limit FROM quota_classes WHERE class_name = 'default'",
+		defaults,
+	), nil
+}
+
+func NewCinderQuotaExporter(db *sql.DB, keystoneDB *sql.DB, defaults map[string]float64) (*QuotaExporter, error) {
+	return newQuotaExporter(db, keystoneDB, "cinder",
+		"SELECT project_id, resource, hard_limit FROM quotas WHERE deleted = 0",
+		"SELECT resource, hard_limit FROM quota_classes WHERE class_name = 'default' AND deleted = 0",
+		defaults,
+	), nil
+}
+
+func NewManilaQuotaExporter(db *sql.DB, keystoneDB *sql.DB, defaults map[string]float64) (*QuotaExporter, error) {
+	return newQuotaExporter(db, keystoneDB, "manila",
+		"SELECT project_id, resource, hard_limit FROM quotas WHERE deleted = 0",
+		"SELECT resource, hard_limit FROM quota_classes WHERE class_name = 'default' AND deleted = 0",
+		defaults,
+	), nil
+}
+
+// NewNeutronQuotaExporter creates a Neutron quota exporter. Neutron keeps its
+// defaults in neutron.conf only, so they have to be configured.
+func NewNeutronQuotaExporter(db *sql.DB, keystoneDB *sql.DB, defaults map[string]float64) (*QuotaExporter, error) {
+	return newQuotaExporter(db, keystoneDB, "neutron",
+		"SELECT project_id, resource, `limit` FROM quotas",
+		"",
+		defaults,
+	), nil
+}
+
+// NewOctaviaQuotaExporter creates an Octavia quota exporter. Octavia keeps its
+// defaults in octavia.conf only, so they have to be configured.
+func NewOctaviaQuotaExporter(db *sql.DB, keystoneDB *sql.DB, defaults map[string]float64) (*QuotaExporter, error) {
+	// Octavia stores one column per resource, NULL meaning the default applies.
+	var selects []string
+	for _, resource := range []string{"load_balancer", "listener", "pool", "member", "health_monitor", "l7policy", "l7rule"} {
+		selects = append(selects, "SELECT project_id, '"+resource+"' AS resource, "+resource+" AS hard_limit FROM quotas WHERE "+resource+" IS NOT NULL")
+	}
+
+	return newQuotaExporter(db, keystoneDB, "octavia",
+		strings.Join(selects, " UNION ALL "),
+		"",
+		defaults,
+	), nil
+}
+
+func (e *QuotaExporter) Describe(ch chan<- *prometheus.Desc) {
+	ch <- e.quota
+	ch <- e.defaultQuota
+}
+
+func (e *QuotaExporter) Collect(ch chan<- prometheus.Metric) {
+	e.collectMetrics(ch)
+}
+
+func (e *QuotaExporter) collectMetrics(ch chan<- prometheus.Metric) error {
+	defaults := make(map[string]float64)
+	for resource, limit := range e.defaults {
+		defaults[resource] = limit
+	}
+
+	if e.defaultsQuery != "" {
+		rows, err := e.db.Query(e.defaultsQuery)
+		if err != nil {
+			log.Println("Error querying default quotas:", err)
+			return &queryError{query: "default_quotas", err: err}
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var resource string
+			var limit float64
+			if err := rows.Scan(&resource, &limit); err != nil {
+				log.Println("Error scanning default quota row:", err)
+				continue
+			}
+			defaults[resource] = limit
+		}
+
+		if err := rows.Err(); err != nil {
+			log.Println("Error in default quotas result set:", err)
+			return &queryError{query: "default_quotas", err: err}
+		}
+	}
+
+	rows, err := e.db.Query(e.quotasQuery)
+	if err != nil {
+		log.Println("Error querying quotas:", err)
+		return &queryError{query: "quotas", err: err}
+	}
+	defer rows.Close()
+
+	quotas := make(map[string]map[string]float64)
+	for rows.Next() {
+		var projectID, resource string
+		var limit float64
+		if err := rows.Scan(&projectID, &resource, &limit); err != nil {
+			log.Println("Error scanning quota row:", err)
+			continue
+		}
+
+		if quotas[projectID] == nil {
+			quotas[projectID] = make(map[string]float64)
+		}
+		quotas[projectID][resource] = limit
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Println("Error in quotas result set:", err)
+		return &queryError{query: "quotas", err: err}
+	}
+
+	if e.keystoneDB != nil {
+		if err := e.collectProjects(quotas); err != nil {
+			return err
+		}
+	}
+
+	for resource, limit := range defaults {
+		ch <- prometheus.MustNewConstMetric(
+			e.defaultQuota,
+			prometheus.GaugeValue,
+			limit,
+			resource,
+		)
+	}
+
+	for projectID, overrides := range quotas {
+		for resource, limit := range defaults {
+			if _, overridden := overrides[resource]; !overridden {
+				ch <- prometheus.MustNewConstMetric(
+					e.quota,
+					prometheus.GaugeValue,
+					limit,
+					projectID, resource,
+				)
+			}
+		}
+
+		for resource, limit := range overrides {
+			ch <- prometheus.MustNewConstMetric(
+				e.quota,
+				prometheus.GaugeValue,
+				limit,
+				projectID, resource,
+			)
+		}
+	}
+
+	return nil
+}
+
+// collectProjects adds all projects without overrides to quotas, so that their
+// default quotas are exposed as well.
+func (e *QuotaExporter) collectProjects(quotas map[string]map[string]float64) error {
+	rows, err := e.keystoneDB.Query("SELECT id FROM project WHERE is_domain = 0")
+	if err != nil {
+		log.Println("Error querying Keystone projects:", err)
+		return &queryError{query: "projects", err: err}
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var projectID string
+		if err := rows.Scan(&projectID); err != nil {
+			log.Println("Error scanning Keystone project row:", err)
+			continue
+		}
+
+		if quotas[projectID] == nil {
+			quotas[projectID] = make(map[string]float64)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Println("Error in Keystone projects result set:", err)
+		return &queryError{query: "projects", err: err}
+	}
+
+	return nil
+}
@@ -0,0 +1,138 @@
+package exporters
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCinderQuotaExporter(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	defaultRows := sqlmock.NewRows([]string{"resource", "hard_limit"}).
+		AddRow("volumes", 10).
+		AddRow("gigabytes", 1000)
+	mock.ExpectQuery("SELECT resource, hard_limit FROM quota_classes WHERE class_name = 'default' AND deleted = 0").WillReturnRows(defaultRows)
+
+	quotaRows := sqlmock.NewRows([]string{"project_id", "resource", "hard_limit"}).
+		AddRow("c352b0ed-30ca-4634-9c2d-1947efc29096", "gigabytes", 5000).
+		AddRow("c352b0ed-30ca-4634-9c2d-1947efc29096", "gigabytes_SSD", 2000)
+	mock.ExpectQuery("SELECT project_id, resource, hard_limit FROM quotas WHERE deleted = 0").WillReturnRows(quotaRows)
+
+	exporter, err := NewCinderQuotaExporter(db, nil, map[string]float64{"volumes": 20, "backups": 10})
+	if err != nil {
+		t.Fatalf("Failed to create NewCinderQuotaExporter: %v", err)
+	}
+
+	expectedMetrics := `
+        # HELP openstack_default_quota_cinder Default quota per cinder resource
+        # TYPE openstack_default_quota_cinder gauge
+        openstack_default_quota_cinder{resource="backups"} 10
+        openstack_default_quota_cinder{resource="gigabytes"} 1000
+        openstack_default_quota_cinder{resource="volumes"} 10
+        # HELP openstack_project_quota_cinder Quota per OpenStack project and cinder resource
+        # TYPE openstack_project_quota_cinder gauge
+        openstack_project_quota_cinder{project_id="c352b0ed-30ca-4634-9c2d-1947efc29096",resource="backups"} 10
+        openstack_project_quota_cinder{project_id="c352b0ed-30ca-4634-9c2d-1947efc29096",resource="gigabytes"} 5000
+        openstack_project_quota_cinder{project_id="c352b0ed-30ca-4634-9c2d-1947efc29096",resource="gigabytes_SSD"} 2000
+        openstack_project_quota_cinder{project_id="c352b0ed-30ca-4634-9c2d-1947efc29096",resource="volumes"} 10
+	`
+
+	if err := testutil.CollectAndCompare(exporter, strings.NewReader(expectedMetrics)); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestOctaviaQuotaExporter(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	quotaRows := sqlmock.NewRows([]string{"project_id", "resource", "hard_limit"}).
+		AddRow("6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096", "load_balancer", 5)
+	mock.ExpectQuery("SELECT project_id, 'load_balancer' AS resource, load_balancer AS hard_limit FROM quotas WHERE load_balancer IS NOT NULL UNION ALL").WillReturnRows(quotaRows)
+
+	exporter, err := NewOctaviaQuotaExporter(db, nil, map[string]float64{"load_balancer": -1, "listener": -1})
+	if err != nil {
+		t.Fatalf("Failed to create NewOctaviaQuotaExporter: %v", err)
+	}
+
+	expectedMetrics := `
+        # HELP openstack_default_quota_octavia Default quota per octavia resource
+        # TYPE openstack_default_quota_octavia gauge
+        openstack_default_quota_octavia{resource="listener"} -1
+        openstack_default_quota_octavia{resource="load_balancer"} -1
+        # HELP openstack_project_quota_octavia Quota per OpenStack project and octavia resource
+        # TYPE openstack_project_quota_octavia gauge
+        openstack_project_quota_octavia{project_id="6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096",resource="listener"} -1
+        openstack_project_quota_octavia{project_id="6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096",resource="load_balancer"} 5
+	`
+
+	if err := testutil.CollectAndCompare(exporter, strings.NewReader(expectedMetrics)); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestNeutronQuotaExporterAllProjects(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	keystoneDB, keystoneMock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create sqlmock: %v", err)
+	}
+	defer keystoneDB.Close()
+
+	quotaRows := sqlmock.NewRows([]string{"project_id", "resource", "limit"}).
+		AddRow("6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096", "router", 20)
+	mock.ExpectQuery("SELECT project_id, resource, `limit` FROM quotas").WillReturnRows(quotaRows)
+
+	projectRows := sqlmock.NewRows([]string{"id"}).
+		AddRow("6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096").
+		AddRow("c352b0ed-30ca-4634-9c2d-1947efc29096")
+	keystoneMock.ExpectQuery("SELECT id FROM project WHERE is_domain = 0").WillReturnRows(projectRows)
+
+	exporter, err := NewNeutronQuotaExporter(db, keystoneDB, map[string]float64{"router": 10, "floatingip": 50})
+	if err != nil {
+		t.Fatalf("Failed to create NewNeutronQuotaExporter: %v", err)
+	}
+
+	expectedMetrics := `
+        # HELP openstack_project_quota_neutron Quota per OpenStack project and neutron resource
+        # TYPE openstack_project_quota_neutron gauge
+        openstack_project_quota_neutron{project_id="6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096",resource="floatingip"} 50
+        openstack_project_quota_neutron{project_id="6ee08ba2-2ca1-4c91-b139-4bf0dbaa4096",resource="router"} 20
+        openstack_project_quota_neutron{project_id="c352b0ed-30ca-4634-9c2d-1947efc29096",resource="floatingip"} 50
+        openstack_project_quota_neutron{project_id="c352b0ed-30ca-4634-9c2d-1947efc29096",resource="router"} 10
+	`
+
+	if err := testutil.CollectAndCompare(exporter, strings.NewReader(expectedMetrics), "openstack_project_quota_neutron"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+	if err := keystoneMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
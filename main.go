@@ -2,22 +2,23 @@ package main
 
 import (
 	"database/sql"
+	"flag"
 	"fmt"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/exporter-toolkit/web"
 	"github.com/scaleup-technologies/openstack-usage-exporter/exporters"
 )
 
-type Exporter interface {
-	prometheus.Collector
-}
-
 func GetBoolEnv(key string, defaultValue bool) bool {
 	value, exists := os.LookupEnv(key)
 	if !exists || strings.TrimSpace(value) == "" {
@@ -26,74 +27,206 @@ func GetBoolEnv(key string, defaultValue bool) bool {
 	return strings.EqualFold(value, "true") || value == "1"
 }
 
-func main() {
-	baseDSN := os.Getenv("BASE_DSN")
+func GetDurationEnv(key string, defaultValue time.Duration) (time.Duration, error) {
+	value, exists := os.LookupEnv(key)
+	if !exists || strings.TrimSpace(value) == "" {
+		return defaultValue, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return defaultValue, fmt.Errorf("invalid duration for %s: %w", key, err)
+	}
+	return duration, nil
+}
 
-	if baseDSN == "" {
-		log.Fatalf("BASE_DSN not set")
+// newNovaCells opens the databases of the configured cells, or discovers the
+// cells from nova_api. Discovered cells are rediscovered on every collection.
+// Without cells, db is the only cell.
+func newNovaCells(cfg *ExporterConfig, db *sql.DB, databases *openedDatabases) (exporters.NovaCells, error) {
+	if len(cfg.Cells) == 0 && !cfg.DiscoverCells {
+		return exporters.StaticNovaCells{{DB: db}}, nil
 	}
 
-	enabledExporters := map[string]bool{
-		"cinder":     GetBoolEnv("CINDER_ENABLED", true),
-		"nova":       GetBoolEnv("NOVA_ENABLED", true),
-		"nova-trait": GetBoolEnv("NOVA_TRAIT_ENABLED", false),
-		"neutron":    GetBoolEnv("NEUTRON_ENABLED", true),
-		"designate":  GetBoolEnv("DESIGNATE_ENABLED", true),
-		"octavia":    GetBoolEnv("OCTAVIA_ENABLED", true),
-		"manila":     GetBoolEnv("MANILA_ENABLED", false),
+	// Cells are discovered on every collection, so nova_api being unreachable
+	// at startup only fails the collections until it is back.
+	if cfg.DiscoverCells {
+		apiDB, err := databases.openDatabase("nova_api")
+		if err != nil {
+			return nil, err
+		}
+		return exporters.NewNovaCellDiscovery(apiDB, databases.cellDSN, databases.open), nil
 	}
 
-	for name, enabled := range enabledExporters {
-		if !enabled {
-			continue
+	var cells exporters.StaticNovaCells
+	for _, database := range cfg.Cells {
+		db, err := databases.openDatabase(database)
+		if err != nil {
+			return nil, err
 		}
+		cells = append(cells, exporters.NovaCell{Name: database, DB: db})
+	}
 
-		dsn := baseDSN + "/" + strings.Split(name, "-")[0]
+	return cells, nil
+}
 
-		db, err := sql.Open("mysql", dsn)
-		if err != nil {
-			log.Fatalf("failed to connect to database: %s", err)
+// newExporter creates the exporter name, opening its databases with
+// databases.
+func newExporter(name string, cfg *ExporterConfig, databases *openedDatabases) (exporters.Exporter, error) {
+	var exporter exporters.Exporter
+	var err error
+
+	// Exporters with cells read the cell databases instead of the service
+	// database.
+	var db *sql.DB
+	if len(cfg.Cells) == 0 && !cfg.DiscoverCells {
+		if db, err = databases.openService(); err != nil {
+			return nil, err
+		}
+	}
+
+	// all_projects is only accepted for the quota exporters.
+	var keystoneDB *sql.DB
+	if cfg.AllProjects {
+		if keystoneDB, err = databases.openDatabase("keystone"); err != nil {
+			return nil, err
 		}
+	}
 
-		var exporter prometheus.Collector
-
-		switch name {
-		case "cinder":
-			exporter, err = exporters.NewCinderUsageExporter(db)
-		case "nova":
-			exporter, err = exporters.NewNovaUsageExporter(db)
-		case "nova-trait":
-			trait, exists := os.LookupEnv("NOVA_TRAIT")
-			if !exists {
-				log.Fatalf("NOVA_TRAIT not set")
+	switch name {
+	case "cinder":
+		exporter, err = exporters.NewCinderUsageExporter(db, cfg.AvailabilityZoneLabel)
+	case "nova":
+		var cells exporters.NovaCells
+		if cells, err = newNovaCells(cfg, db, databases); err != nil {
+			return nil, err
+		}
+		exporter, err = exporters.NewNovaCellsUsageExporter(cells, cfg.CellLabel, cfg.AvailabilityZoneLabel)
+	case "nova-trait":
+		exporter, err = exporters.NewNovaTraitUsageExporter(db, cfg.Traits)
+	case "nova-pci":
+		var cells exporters.NovaCells
+		if cells, err = newNovaCells(cfg, db, databases); err != nil {
+			return nil, err
+		}
+		var placementDB *sql.DB
+		if cfg.VGPUs {
+			if placementDB, err = databases.openDatabase("placement"); err != nil {
+				return nil, err
 			}
-			exporter, err = exporters.NewNovaTraitUsageExporter(db, trait)
-		case "neutron":
-			externalNetworkId, exists := os.LookupEnv("NEUTRON_ROUTER_EXTERNAL_NETWORK_ID")
-			if !exists {
-				log.Fatalf("NEUTRON_ROUTER_EXTERNAL_NETWORK_ID not set")
+		}
+		exporter, err = exporters.NewNovaPCIUsageExporter(cells, placementDB)
+	case "neutron":
+		exporter, err = exporters.NewNeutronUsageExporter(db, cfg.ExternalNetworkIDs)
+	case "designate":
+		exporter, err = exporters.NewDesignateUsageExporter(db)
+	case "octavia":
+		exporter, err = exporters.NewOctaviaUsageExporter(db)
+	case "manila":
+		exporter, err = exporters.NewManilaUsageExporter(db, cfg.AvailabilityZoneLabel)
+	case "glance":
+		exporter, err = exporters.NewGlanceUsageExporter(db)
+	case "keystone":
+		exporter, err = exporters.NewKeystoneProjectInfoExporter(db, cfg.RefreshInterval)
+	case "placement-capacity":
+		// Aggregate names are read from nova_api, which is only known with a
+		// base DSN.
+		var apiDB *sql.DB
+		if databases.baseDSN != "" {
+			if apiDB, err = databases.openDatabase("nova_api"); err != nil {
+				return nil, err
 			}
-			exporter, err = exporters.NewNeutronUsageExporter(db, externalNetworkId)
-		case "designate":
-			exporter, err = exporters.NewDesignateUsageExporter(db)
-		case "octavia":
-			exporter, err = exporters.NewOctaviaUsageExporter(db)
-		case "manila":
-			exporter, err = exporters.NewManilaUsageExporter(db)
-		default:
-			log.Fatalf("unknown exporter type: %s", name)
 		}
+		exporter, err = exporters.NewPlacementCapacityExporter(db, apiDB)
+	case "placement-usage":
+		exporter, err = exporters.NewPlacementUsageExporter(db)
+	case "nova-quota":
+		exporter, err = exporters.NewNovaQuotaExporter(db, keystoneDB, cfg.Defaults)
+	case "cinder-quota":
+		exporter, err = exporters.NewCinderQuotaExporter(db, keystoneDB, cfg.Defaults)
+	case "neutron-quota":
+		exporter, err = exporters.NewNeutronQuotaExporter(db, keystoneDB, cfg.Defaults)
+	case "manila-quota":
+		exporter, err = exporters.NewManilaQuotaExporter(db, keystoneDB, cfg.Defaults)
+	case "octavia-quota":
+		exporter, err = exporters.NewOctaviaQuotaExporter(db, keystoneDB, cfg.Defaults)
+	default:
+		return nil, fmt.Errorf("unknown exporter type: %s", name)
+	}
 
-		if err != nil {
-			log.Fatalf("failed to initialize exporter: %s", err)
+	if err != nil {
+		return nil, err
+	}
+
+	return exporter, nil
+}
+
+func main() {
+	configFile := flag.String("config.file", os.Getenv("CONFIG_FILE"), "Path to the YAML configuration file")
+	webConfigFile := flag.String("web.config.file", os.Getenv("WEB_CONFIG_FILE"), "Path to the exporter-toolkit web configuration file enabling TLS or basic authentication")
+	flag.Parse()
+
+	cfg, err := LoadConfig(*configFile)
+	if err != nil {
+		log.Fatalf("invalid configuration: %s", err)
+	}
+	if err := web.Validate(*webConfigFile); err != nil {
+		log.Fatalf("invalid web configuration: %s", err)
+	}
+
+	var collectors []registeredCollector
+	databases := &databaseRegistry{}
+	for _, region := range cfg.Targets() {
+		registerer := prometheus.DefaultRegisterer
+		if region.Name != "" {
+			registerer = prometheus.WrapRegistererWith(prometheus.Labels{"region": region.Name}, registerer)
+		}
+
+		for _, name := range cfg.EnabledExporters() {
+			opened := &openedDatabases{
+				registry:   databases,
+				name:       name,
+				baseDSN:    region.BaseDSN,
+				serviceDSN: cfg.ExporterDSN(region, name),
+			}
+			if region.Name != "" {
+				opened.name = region.Name + "/" + name
+			}
+
+			// A broken region must not keep the other regions from being exported.
+			exporter, err := newExporter(name, cfg.Exporters[name], opened)
+			if err != nil {
+				log.Printf("failed to initialize %s exporter of region %q: %s", name, region.Name, err)
+				opened.close()
+				continue
+			}
+			opened.register()
+
+			// Without an interval every scrape queries the databases. With an interval
+			// the exporters run in the background and scrapes serve the cached result.
+			collector := exporters.NewCollector(name, exporter, cfg.CollectInterval)
+			collector.Start()
+			registerer.MustRegister(collector)
+			collectors = append(collectors, registeredCollector{Region: region.Name, Collector: collector})
 		}
+	}
 
-		prometheus.MustRegister(exporter)
+	mux := http.NewServeMux()
+	mux.Handle(cfg.MetricsPath, promhttp.Handler())
+	mux.Handle("/healthz", healthHandler())
+	mux.Handle("/readyz", readinessHandler(databases))
+	mux.Handle("/", landingPageHandler(cfg, collectors))
 
+	var listeners []net.Listener
+	for _, address := range cfg.ListenAddresses {
+		listener, err := listen(address)
+		if err != nil {
+			log.Fatalf("failed to listen on %s: %s", address, err)
+		}
+		listeners = append(listeners, listener)
 	}
 
-	HTTP_BIND := ":9143"
-	http.Handle("/metrics", promhttp.Handler())
-	fmt.Println("Starting OpenStack Usage exporter on /metrics")
-	log.Fatal(http.ListenAndServe(HTTP_BIND, nil))
+	fmt.Printf("Starting OpenStack Usage exporter on %s\n", strings.Join(cfg.ListenAddresses, ", "))
+	server := &http.Server{Handler: mux}
+	flags := &web.FlagConfig{WebConfigFile: webConfigFile}
+	log.Fatal(web.ServeMultiple(listeners, server, flags, slog.New(slog.NewTextHandler(os.Stderr, nil))))
 }
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"html/template"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/scaleup-technologies/openstack-usage-exporter/exporters"
+	"gopkg.in/yaml.v3"
+)
+
+// registeredCollector is a collector served by this process.
+type registeredCollector struct {
+	Region    string
+	Collector *exporters.Collector
+}
+
+var landingPageTemplate = template.Must(template.New("landing").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<title>OpenStack Usage Exporter</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.8em; text-align: left; }
+.failed { color: #b00; }
+pre { background: #f4f4f4; padding: 1em; }
+</style>
+</head>
+<body>
+<h1>OpenStack Usage Exporter</h1>
+<p><a href="{{.MetricsPath}}">Metrics</a></p>
+<h2>Exporters</h2>
+<table>
+<tr>{{if .Regions}}<th>Region</th>{{end}}<th>Exporter</th><th>Last collection</th><th>Last success</th><th>Duration</th></tr>
+{{range .Collectors}}{{$status := .Collector.Status}}<tr>
+{{if $.Regions}}<td>{{.Region}}</td>{{end}}
+<td>{{$status.Name}}</td>
+{{if not $status.HasRun}}<td>pending</td>{{else if $status.LastRunSucceeded}}<td>succeeded</td>{{else}}<td class="failed">failed</td>{{end}}
+<td>{{if not $status.LastSuccess.IsZero}}{{$status.LastSuccess.Format "2006-01-02 15:04:05 MST"}}{{else}}never{{end}}</td>
+<td>{{if $status.HasRun}}{{$status.LastDuration}}{{end}}</td>
+</tr>
+{{end}}</table>
+<h2>Configuration</h2>
+<pre>{{.Config}}</pre>
+</body>
+</html>
+`))
+
+// landingPageHandler shows the enabled exporters with the status of their
+// last collection and the configuration without passwords.
+func landingPageHandler(cfg *Config, collectors []registeredCollector) http.Handler {
+	// Only enabled exporters are of interest.
+	redacted := cfg.Redacted()
+	for name, exporter := range redacted.Exporters {
+		if !*exporter.Enabled {
+			delete(redacted.Exporters, name)
+		}
+	}
+	config, err := yaml.Marshal(redacted)
+	if err != nil {
+		log.Printf("failed to render configuration: %s", err)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		err := landingPageTemplate.Execute(w, struct {
+			MetricsPath string
+			Regions     bool
+			Collectors  []registeredCollector
+			Config      string
+		}{
+			MetricsPath: cfg.MetricsPath,
+			Regions:     len(cfg.Regions) > 0,
+			Collectors:  collectors,
+			Config:      string(config),
+		})
+		if err != nil {
+			log.Printf("failed to render landing page: %s", err)
+		}
+	})
+}
+
+// namedDatabase is a database opened by an exporter, named after the region,
+// the exporter and, except for the service database, the database name.
+type namedDatabase struct {
+	Name string
+	DB   *sql.DB
+}
+
+// databaseRegistry holds the databases checked for readiness.
+type databaseRegistry struct {
+	mu        sync.Mutex
+	databases []namedDatabase
+}
+
+func (r *databaseRegistry) add(databases ...namedDatabase) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.databases = append(r.databases, databases...)
+}
+
+func (r *databaseRegistry) list() []namedDatabase {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]namedDatabase(nil), r.databases...)
+}
+
+// Default timeouts for database connections whose DSN does not set timeout
+// or readTimeout, so that an unresponsive database fails the collection
+// instead of blocking it.
+const (
+	defaultDialTimeout = 5 * time.Second
+	defaultReadTimeout = 30 * time.Second
+)
+
+// openedDatabases opens the databases of one exporter. They are added to the
+// registry once the exporter is initialized, so that exporters failing to
+// initialize are not checked. Databases opened afterwards, i.e. of newly
+// discovered cells, are added right away.
+type openedDatabases struct {
+	registry *databaseRegistry
+	name     string
+	// baseDSN is the DSN of the region without database, serviceDSN the
+	// DSN of the service database of the exporter.
+	baseDSN    string
+	serviceDSN string
+
+	mu          sync.Mutex
+	opened      []namedDatabase
+	initialized bool
+}
+
+// open opens the database with the given DSN. database is empty for the
+// service database of the exporter.
+func (d *openedDatabases) open(database, dsn string) (*sql.DB, error) {
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = defaultDialTimeout
+	}
+	if cfg.ReadTimeout == 0 {
+		cfg.ReadTimeout = defaultReadTimeout
+	}
+	connector, err := mysql.NewConnector(cfg)
+	if err != nil {
+		return nil, err
+	}
+	db := sql.OpenDB(connector)
+
+	name := d.name
+	if database != "" {
+		name += "/" + database
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.initialized {
+		d.registry.add(namedDatabase{Name: name, DB: db})
+	} else {
+		d.opened = append(d.opened, namedDatabase{Name: name, DB: db})
+	}
+	return db, nil
+}
+
+// openService opens the service database of the exporter.
+func (d *openedDatabases) openService() (*sql.DB, error) {
+	return d.open("", d.serviceDSN)
+}
+
+// openDatabase opens a further database of the region, e.g. nova_api.
+func (d *openedDatabases) openDatabase(database string) (*sql.DB, error) {
+	return d.open(database, d.baseDSN+"/"+database)
+}
+
+// cellDSN returns the DSN of a Nova cell database. The credentials and
+// parameters of the base DSN are used, the address of the cell database
+// server if the cell names one.
+func (d *openedDatabases) cellDSN(cell exporters.NovaCellDatabase) (string, error) {
+	cfg, err := mysql.ParseDSN(d.baseDSN + "/" + cell.Database)
+	if err != nil {
+		return "", err
+	}
+	if cell.Address != "" {
+		cfg.Net = "tcp"
+		cfg.Addr = cell.Address
+	}
+	return cfg.FormatDSN(), nil
+}
+
+// register adds the databases opened so far to the registry.
+func (d *openedDatabases) register() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.registry.add(d.opened...)
+	d.opened = nil
+	d.initialized = true
+}
+
+// close closes the databases of an exporter that failed to initialize.
+func (d *openedDatabases) close() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, database := range d.opened {
+		database.DB.Close()
+	}
+	d.opened = nil
+}
+
+// healthHandler reports that the process is alive.
+func healthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "OK")
+	})
+}
+
+// readinessHandler pings all registered databases and fails if any of them
+// is unreachable, naming the unreachable ones.
+func readinessHandler(registry *databaseRegistry) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		defer cancel()
+
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		var failures []string
+		for _, database := range registry.list() {
+			wg.Add(1)
+			go func(database namedDatabase) {
+				defer wg.Done()
+				if err := database.DB.PingContext(ctx); err != nil {
+					mu.Lock()
+					failures = append(failures, fmt.Sprintf("%s: %s", database.Name, err))
+					mu.Unlock()
+				}
+			}(database)
+		}
+		wg.Wait()
+
+		if len(failures) > 0 {
+			sort.Strings(failures)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			for _, failure := range failures {
+				fmt.Fprintln(w, failure)
+			}
+			return
+		}
+		fmt.Fprintln(w, "OK")
+	})
+}
+
+// listen opens a listener on address, which is either a TCP address or a
+// unix socket given as unix:///path/to/socket.
+func listen(address string) (net.Listener, error) {
+	path, isUnix := strings.CutPrefix(address, "unix://")
+	if !isUnix {
+		return net.Listen("tcp", address)
+	}
+
+	// A socket left behind by a previous run would make listening fail.
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	return net.Listen("unix", path)
+}
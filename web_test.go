@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/scaleup-technologies/openstack-usage-exporter/exporters"
+)
+
+func TestHealthHandler(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	healthHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	if recorder.Code != http.StatusOK || recorder.Body.String() != "OK\n" {
+		t.Errorf("unexpected response: %d %q", recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestReadinessHandler(t *testing.T) {
+	tests := []struct {
+		name     string
+		pingErrs []error
+		code     int
+		body     string
+	}{
+		{
+			name: "no databases",
+			code: http.StatusOK,
+			body: "OK\n",
+		},
+		{
+			name:     "all databases reachable",
+			pingErrs: []error{nil, nil},
+			code:     http.StatusOK,
+			body:     "OK\n",
+		},
+		{
+			name:     "unreachable databases",
+			pingErrs: []error{errors.New("connection refused"), nil, errors.New("timeout")},
+			code:     http.StatusServiceUnavailable,
+			body:     "regionone/nova/nova_cell0: connection refused\nregionone/nova/nova_cell2: timeout\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			registry := &databaseRegistry{}
+			for i, pingErr := range test.pingErrs {
+				db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+				if err != nil {
+					t.Fatalf("Failed to create sqlmock: %v", err)
+				}
+				defer db.Close()
+				mock.ExpectPing().WillReturnError(pingErr)
+
+				registry.add(namedDatabase{Name: fmt.Sprintf("regionone/nova/nova_cell%d", i), DB: db})
+			}
+
+			recorder := httptest.NewRecorder()
+			readinessHandler(registry).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+			if recorder.Code != test.code || recorder.Body.String() != test.body {
+				t.Errorf("unexpected response: %d %q", recorder.Code, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestCellDSN(t *testing.T) {
+	tests := []struct {
+		baseDSN  string
+		cell     exporters.NovaCellDatabase
+		expected string
+	}{
+		{
+			baseDSN:  "user:secret@tcp(db:3306)",
+			cell:     exporters.NovaCellDatabase{Database: "nova_cell1"},
+			expected: "user:secret@tcp(db:3306)/nova_cell1",
+		},
+		{
+			baseDSN:  "user:secret@tcp(db:3306)",
+			cell:     exporters.NovaCellDatabase{Address: "db1:3307", Database: "nova"},
+			expected: "user:secret@tcp(db1:3307)/nova",
+		},
+		{
+			baseDSN:  "user:secret@unix(/run/mysqld/mysqld.sock)",
+			cell:     exporters.NovaCellDatabase{Address: "db2", Database: "nova"},
+			expected: "user:secret@tcp(db2)/nova",
+		},
+	}
+
+	for _, test := range tests {
+		databases := &openedDatabases{baseDSN: test.baseDSN}
+		dsn, err := databases.cellDSN(test.cell)
+		if err != nil {
+			t.Errorf("cellDSN(%v) failed: %v", test.cell, err)
+		} else if dsn != test.expected {
+			t.Errorf("cellDSN(%v) = %q, expected %q", test.cell, dsn, test.expected)
+		}
+	}
+}